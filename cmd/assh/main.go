@@ -9,6 +9,7 @@ import (
 	"github.com/urfave/cli"
 
 	"github.com/noqqe/advanced-ssh-config/pkg/commands"
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
 	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
 	"github.com/noqqe/advanced-ssh-config/pkg/version"
 )
@@ -30,6 +31,11 @@ func main() {
 			Value:  "~/.ssh/assh.yml",
 			Usage:  "Location of config file",
 		},
+		cli.StringFlag{
+			Name:   "profile",
+			EnvVar: "ASSH_PROFILE",
+			Usage:  "Name of the configuration profile to apply",
+		},
 		cli.BoolFlag{
 			Name:   "debug, D",
 			EnvVar: "ASSH_DEBUG",
@@ -50,10 +56,10 @@ func main() {
 
 func BashComplete(c *cli.Context) {
 	if len(c.Args()) == 0 {
-		for _, option := range []string{"--debug", "--verbose", "--help", "--version"} {
+		for _, option := range []string{"--debug", "--verbose", "--profile", "--help", "--version"} {
 			fmt.Println(option)
 		}
-		for _, command := range []string{"connect", "config", "info", "sockets", "help"} {
+		for _, command := range []string{"connect", "config", "etc-hosts", "info", "sockets", "help"} {
 			fmt.Println(command)
 		}
 	}
@@ -64,6 +70,7 @@ func hookBefore(c *cli.Context) error {
 		os.Setenv("ASSH_DEBUG", "1")
 	}
 	initLogging(c.Bool("debug"), c.Bool("verbose"))
+	config.SetASSHProfile(c.String("profile"))
 	return nil
 }
 
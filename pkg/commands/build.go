@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -26,7 +27,15 @@ func cmdBuild(c *cli.Context) error {
 		}
 	}
 
-	conf.WriteSSHConfigTo(os.Stdout)
+	// the configuration is written once complete, an error in a host does
+	// not leave a partial output
+	var buf bytes.Buffer
+	if err = conf.WriteSSHConfigTo(&buf); err != nil {
+		Logger.Fatalf("Cannot build SSH config: %v", err)
+	}
+	if _, err = buf.WriteTo(os.Stdout); err != nil {
+		Logger.Fatalf("Cannot write SSH config: %v", err)
+	}
 
 	return nil
 }
@@ -48,14 +48,22 @@ var Commands = []cli.Command{
 			Action:      cmdInit,
 		},
 	*/
-	/*
-		{
-			Name:        "etc-hosts",
-			Usage:       "Generate a /etc/hosts file with assh hosts",
-			Description: "Build a .ssh/config.advanced file based on .ssh/config and update .ssh/config to use assh as ProxyCommand.",
-			Action:      cmdEtcHosts,
+	{
+		Name:        "etc-hosts",
+		Usage:       "Generate a /etc/hosts file with assh hosts",
+		Description: "Print a /etc/hosts entry for each host (and its aliases) whose HostName is an IP address, or update the assh section of a file.",
+		Action:      cmdEtcHosts,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "resolve",
+				Usage: "Run the ResolveCommand of the hosts",
+			},
+			cli.StringFlag{
+				Name:  "write, w",
+				Usage: "Update the section delimited by the assh markers in a file (i.e: /etc/hosts) instead of printing",
+			},
 		},
-	*/
+	},
 	{
 		Name:   "info",
 		Usage:  "Display system-wide information",
@@ -91,12 +99,140 @@ var Commands = []cli.Command{
 				Name:   "list",
 				Usage:  "List all hosts from assh config",
 				Action: cmdList,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "origin",
+						Usage: "Show the file and line defining each host and option",
+					},
+				},
 			},
 			{
 				Name:   "search",
 				Usage:  "Search entries by given search text",
 				Action: cmdSearch,
 			},
+			{
+				Name:      "explain",
+				Usage:     "Explain which host definition matches a target",
+				ArgsUsage: "<target>",
+				Action:    cmdExplain,
+			},
+			{
+				Name:   "tree",
+				Usage:  "Display the inheritance and gateway graphs",
+				Action: cmdTree,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format, f",
+						Value: "ascii",
+						Usage: "Output format (ascii, dot, json)",
+					},
+				},
+			},
+			{
+				Name:   "validate",
+				Usage:  "Validate assh config and report issues with their location",
+				Action: cmdValidate,
+			},
+			{
+				Name:   "schema",
+				Usage:  "Print the JSON Schema of the configuration files",
+				Action: cmdSchema,
+			},
+			{
+				Name:   "watch",
+				Usage:  "Rebuild .ssh/config each time the configuration files change",
+				Action: cmdWatch,
+				Flags: []cli.Flag{
+					cli.DurationFlag{
+						Name:  "delay, d",
+						Value: config.DefaultWatchDelay,
+						Usage: "Time without changes waited before rebuilding",
+					},
+				},
+			},
+			{
+				Name:   "export",
+				Usage:  "Export the hosts to another tool format",
+				Action: cmdExport,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format, f",
+						Value: "ansible",
+						Usage: "Export format (ansible)",
+					},
+					cli.StringFlag{
+						Name:  "output, o",
+						Usage: "Write the result to a file instead of stdout, a .yml extension selects the YAML inventory format",
+					},
+					cli.BoolFlag{
+						Name:  "yaml",
+						Usage: "Write a YAML inventory instead of an INI inventory",
+					},
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "Convert an OpenSSH config file into assh.yml format",
+				ArgsUsage: "[~/.ssh/config]",
+				Action:    cmdImport,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "output, o",
+						Usage: "Write the result to a file instead of stdout",
+					},
+				},
+			},
+			{
+				Name:      "sign",
+				Usage:     "Write the detached ed25519 signatures of shared configuration files",
+				ArgsUsage: "<file> [<file>...]",
+				Action:    cmdSign,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "key, k",
+						Value: config.DefaultSigningKey,
+						Usage: "ed25519 private key file, generated if it does not exist",
+					},
+				},
+			},
+			{
+				Name:      "encrypt",
+				Usage:     "Encrypt a configuration file with a passphrase or for an X25519 key",
+				ArgsUsage: "<file>",
+				Action:    cmdEncrypt,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "key, k",
+						Usage: "Encrypt for the X25519 private key file, generated if it does not exist",
+					},
+					cli.StringFlag{
+						Name:  "recipient, r",
+						Usage: "Encrypt for the base64-encoded X25519 public key",
+					},
+					cli.StringFlag{
+						Name:  "output, o",
+						Usage: "Write the result to a file instead of stdout",
+					},
+				},
+			},
+			{
+				Name:      "decrypt",
+				Usage:     "Decrypt an encrypted configuration file",
+				ArgsUsage: "<file>",
+				Action:    cmdDecrypt,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "key, k",
+						Value: config.DefaultEncryptionKey,
+						Usage: "X25519 private key of the files encrypted for a key",
+					},
+					cli.StringFlag{
+						Name:  "output, o",
+						Usage: "Write the result to a file instead of stdout",
+					},
+				},
+			},
 		},
 	},
 	{
@@ -120,7 +256,6 @@ var Commands = []cli.Command{
 			},
 		},
 	},
-	// FIXME: tree
 	{
 		Name:   "wrapper",
 		Usage:  "Initialize assh, then run ssh/scp/rsync...",
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+func cmdEncrypt(c *cli.Context) error {
+	input := readConfigArg(c)
+	if config.IsEncrypted(input) {
+		Logger.Fatalf("%q is already encrypted", c.Args().First())
+	}
+	format := config.DetectFormat(c.Args().First(), input)
+
+	var output []byte
+	var err error
+	switch {
+	case c.String("recipient") != "":
+		recipient, keyErr := config.DecodeKey(c.String("recipient"))
+		if keyErr != nil {
+			Logger.Fatalf("Invalid recipient: %v", keyErr)
+		}
+		output, err = config.EncryptForKey(input, format, recipient)
+	case c.String("key") != "":
+		output, err = config.EncryptForKey(input, format, encryptionPublicKey(c.String("key")))
+	default:
+		output, err = config.EncryptWithPassphrase(input, format, askNewPassphrase())
+	}
+	if err != nil {
+		Logger.Fatalf("Cannot encrypt %q: %v", c.Args().First(), err)
+	}
+
+	writeConfigOutput(c, output)
+	return nil
+}
+
+// askNewPassphrase asks the passphrase twice, unless it is set with ASSH_PASSPHRASE
+func askNewPassphrase() []byte {
+	passphrase, err := config.ReadPassphrase("Passphrase: ")
+	if err != nil {
+		Logger.Fatalf("Cannot read the passphrase: %v", err)
+	}
+	if os.Getenv("ASSH_PASSPHRASE") != "" {
+		return passphrase
+	}
+	confirmation, err := config.ReadPassphrase("Confirm the passphrase: ")
+	if err != nil {
+		Logger.Fatalf("Cannot read the passphrase: %v", err)
+	}
+	if !bytes.Equal(passphrase, confirmation) {
+		Logger.Fatalf("The passphrases do not match")
+	}
+	return passphrase
+}
+
+// encryptionPublicKey returns the public key of the private key file,
+// generating the file if it does not exist
+func encryptionPublicKey(keyFile string) *[32]byte {
+	privateKey, err := config.LoadPrivateKey(keyFile)
+	if err == nil {
+		return config.PublicKey(privateKey)
+	}
+	if !os.IsNotExist(err) {
+		Logger.Fatalf("Cannot read the key: %v", err)
+	}
+
+	publicKey, err := config.GenerateKeyFile(keyFile)
+	if err != nil {
+		Logger.Fatalf("Cannot generate the key: %v", err)
+	}
+	Logger.Infof("Generated %s (public key: %s), install it as %s or set EncryptionKey where the files are decrypted", keyFile, config.EncodeKey(publicKey), config.DefaultEncryptionKey)
+	return publicKey
+}
+
+func cmdDecrypt(c *cli.Context) error {
+	input := readConfigArg(c)
+	if !config.IsEncrypted(input) {
+		Logger.Fatalf("%q is not encrypted", c.Args().First())
+	}
+
+	passphrase := func() ([]byte, error) {
+		return config.ReadPassphrase("Passphrase: ")
+	}
+	output, _, err := config.Decrypt(input, passphrase, c.String("key"))
+	if err != nil {
+		Logger.Fatalf("Cannot decrypt %q: %v", c.Args().First(), err)
+	}
+
+	writeConfigOutput(c, output)
+	return nil
+}
+
+func readConfigArg(c *cli.Context) []byte {
+	if len(c.Args()) != 1 {
+		Logger.Fatalf("assh: \"config %s\" requires 1 argument. See 'assh config %s --help'.", c.Command.Name, c.Command.Name)
+	}
+	path, err := utils.ExpandUser(c.Args().First())
+	if err != nil {
+		Logger.Fatalf("Cannot expand %q: %v", c.Args().First(), err)
+	}
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		Logger.Fatalf("Cannot read %q: %v", c.Args().First(), err)
+	}
+	return input
+}
+
+func writeConfigOutput(c *cli.Context, output []byte) {
+	if path := c.String("output"); path != "" {
+		// the decrypted files contain the clear text configuration
+		if err := ioutil.WriteFile(path, output, 0600); err != nil {
+			Logger.Fatalf("Cannot write %q: %v", path, err)
+		}
+		return
+	}
+	fmt.Print(string(output))
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+func cmdEtcHosts(c *cli.Context) error {
+	conf, err := config.Open(c.GlobalString("config"))
+	if err != nil {
+		Logger.Fatalf("Cannot open configuration file: %v", err)
+	}
+
+	var generated bytes.Buffer
+	writeEtcHosts(&generated, conf, c.Bool("resolve"))
+
+	target := c.String("write")
+	if target == "" {
+		fmt.Print(generated.String())
+		return nil
+	}
+
+	existing, err := ioutil.ReadFile(target)
+	if err != nil && !os.IsNotExist(err) {
+		Logger.Fatalf("Cannot read %q: %v", target, err)
+	}
+	content, edited, err := config.MergeManagedSection(existing, generated.Bytes())
+	if err != nil {
+		Logger.Fatalf("Cannot update %q: %v", target, err)
+	}
+	if edited {
+		Logger.Warnf("The assh section of %q was edited manually, the changes are overwritten", target)
+	}
+	// the existing file keeps its mode
+	if err = utils.WriteFileAtomic(target, content, 0644); err != nil {
+		Logger.Fatalf("Cannot write %q: %v", target, err)
+	}
+	return nil
+}
+
+// writeEtcHosts writes a /etc/hosts line for each host (and its aliases)
+// whose HostName is an IP address, the patterns are skipped
+func writeEtcHosts(w io.Writer, conf *config.Config, resolve bool) {
+	fmt.Fprintln(w, "# hosts of the assh configuration")
+	for _, host := range conf.Hosts.SortedList() {
+		if config.IsPattern(host.Name()) {
+			continue
+		}
+
+		computedHost, err := conf.GetHost(host.Name())
+		if err != nil {
+			Logger.Warnf("Cannot get host %q: %v", host.Name(), err)
+			continue
+		}
+		if resolve {
+			if err = hostPrepare(computedHost); err != nil {
+				Logger.Warnf("Cannot resolve host %q: %v", host.Name(), err)
+				continue
+			}
+		}
+		if net.ParseIP(computedHost.HostName) == nil {
+			continue
+		}
+
+		names := []string{computedHost.Name()}
+		for _, alias := range computedHost.Aliases {
+			if !config.IsPattern(alias) {
+				names = append(names, alias)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", computedHost.HostName, strings.Join(names, " "))
+	}
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+)
+
+func TestWriteEtcHosts(t *testing.T) {
+	Convey("Testing writeEtcHosts()", t, FailureContinues, func() {
+		conf := config.New()
+		So(conf.LoadConfig(strings.NewReader(`
+hosts:
+  aaa:
+    HostName: 1.2.3.4
+    Aliases: [a, "a-*"]
+  bbb:
+    HostName: bbb.example.com
+  "*.ccc":
+    HostName: 1.3.5.7
+  ddd:
+    HostName: "fe80::1"
+  eee:
+    ResolveCommand: /bin/sh -c "echo 42.42.42.42"
+`)), ShouldBeNil)
+
+		var buffer bytes.Buffer
+		writeEtcHosts(&buffer, conf, false)
+		So(buffer.String(), ShouldEqual, "# hosts of the assh configuration\n1.2.3.4\taaa a\nfe80::1\tddd\n")
+
+		buffer.Reset()
+		writeEtcHosts(&buffer, conf, true)
+		So(buffer.String(), ShouldEqual, "# hosts of the assh configuration\n1.2.3.4\taaa a\nfe80::1\tddd\n42.42.42.42\teee\n")
+	})
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdExplain(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		Logger.Fatalf("assh: \"config explain\" requires 1 argument. See 'assh config explain --help'.")
+	}
+	target := c.Args()[0]
+
+	conf, err := config.Open(c.GlobalString("config"))
+	if err != nil {
+		Logger.Fatalf("Cannot load configuration: %v", err)
+		return nil
+	}
+
+	matches, err := conf.ExplainHost(target)
+	if err != nil {
+		Logger.Fatalf("Cannot explain %q: %v", target, err)
+	}
+
+	if len(matches) == 0 {
+		fmt.Printf("No host matches %q, assh will use the defaults only.\n", target)
+		return nil
+	}
+
+	fmt.Printf("Candidates for %s:\n", target)
+	for idx, match := range matches {
+		order := "-"
+		if match.Order >= 0 {
+			order = fmt.Sprintf("#%d", match.Order+1)
+		}
+		fmt.Printf("    %d. %s (%s of %q, %d literal characters, %d wildcards, declared %s)\n", idx+1, match.Pattern, match.KindString(), match.Name, match.Specificity, match.Wildcards, order)
+		fmt.Printf("        %s\n", match.Reason)
+	}
+
+	return nil
+}
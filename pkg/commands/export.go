@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdExport(c *cli.Context) error {
+	if format := c.String("format"); format != "ansible" {
+		Logger.Fatalf("Unknown export format %q, supported formats: ansible", format)
+	}
+
+	conf, err := config.Open(c.GlobalString("config"))
+	if err != nil {
+		Logger.Fatalf("Cannot open configuration file: %v", err)
+	}
+
+	output := c.String("output")
+	inventoryFormat := config.AnsibleFormatINI
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".yml", ".yaml":
+		inventoryFormat = config.AnsibleFormatYAML
+	}
+	if c.Bool("yaml") {
+		inventoryFormat = config.AnsibleFormatYAML
+	}
+
+	var buffer bytes.Buffer
+	if err = conf.WriteAnsibleInventory(&buffer, inventoryFormat); err != nil {
+		Logger.Fatalf("Cannot export the hosts: %v", err)
+	}
+
+	if output != "" {
+		if err = ioutil.WriteFile(output, buffer.Bytes(), 0644); err != nil {
+			Logger.Fatalf("Cannot write %q: %v", output, err)
+		}
+		return nil
+	}
+
+	fmt.Print(buffer.String())
+	return nil
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdImport(c *cli.Context) error {
+	source := "~/.ssh/config"
+	if len(c.Args()) > 0 {
+		source = c.Args()[0]
+	}
+
+	conf, warnings, err := config.ImportSSHConfig(source)
+	if err != nil {
+		Logger.Fatalf("Cannot import %q: %v", source, err)
+	}
+	for _, warning := range warnings {
+		Logger.Warnf("%s", warning)
+	}
+
+	out, err := conf.YamlString()
+	if err != nil {
+		Logger.Fatalf("YAML encoding error: %v", err)
+	}
+
+	if output := c.String("output"); output != "" {
+		if err := ioutil.WriteFile(output, out, 0644); err != nil {
+			Logger.Fatalf("Cannot write %q: %v", output, err)
+		}
+		Logger.Infof("Imported %d hosts from %q into %q", len(conf.Hosts), source, output)
+		return nil
+	}
+
+	fmt.Print(string(out))
+	return nil
+}
@@ -30,6 +30,15 @@ func cmdList(c *cli.Context) error {
 		yellowColorize = ansi.ColorFunc("yellow")
 	}
 
+	// origins
+	showOrigin := c.Bool("origin")
+	originOf := func(path ...string) string {
+		if origin, found := conf.OriginOf(path...); found {
+			return fmt.Sprintf(" (%s)", origin)
+		}
+		return ""
+	}
+
 	fmt.Printf("Listing entries\n\n")
 
 	for _, host := range conf.Hosts.SortedList() {
@@ -37,9 +46,16 @@ func cmdList(c *cli.Context) error {
 		options.Remove("User")
 		options.Remove("Port")
 		host.ApplyDefaults(&conf.Defaults)
-		fmt.Printf("    %s -> %s\n", greenColorize(host.Name()), host.Prototype())
-		if len(options) > 0 {
-			fmt.Printf("        %s %s\n", yellowColorize("[custom options]"), strings.Join(options.ToStringList(), " "))
+		if showOrigin {
+			fmt.Printf("    %s -> %s%s\n", greenColorize(host.Name()), host.Prototype(), originOf("hosts", host.Name()))
+			for _, opt := range options {
+				fmt.Printf("        %s: %s%s\n", yellowColorize(opt.Name), opt.Value, originOf("hosts", host.Name(), opt.Name))
+			}
+		} else {
+			fmt.Printf("    %s -> %s\n", greenColorize(host.Name()), host.Prototype())
+			if len(options) > 0 {
+				fmt.Printf("        %s %s\n", yellowColorize("[custom options]"), strings.Join(options.ToStringList(), " "))
+			}
 		}
 		fmt.Println()
 	}
@@ -48,7 +64,11 @@ func cmdList(c *cli.Context) error {
 	if len(generalOptions) > 0 {
 		fmt.Println(greenColorize("    (*) General options:"))
 		for _, opt := range conf.Defaults.Options() {
-			fmt.Printf("        %s: %s\n", redColorize(opt.Name), opt.Value)
+			if showOrigin {
+				fmt.Printf("        %s: %s%s\n", redColorize(opt.Name), opt.Value, originOf("defaults", opt.Name))
+			} else {
+				fmt.Printf("        %s: %s\n", redColorize(opt.Name), opt.Value)
+			}
 		}
 		fmt.Println()
 	}
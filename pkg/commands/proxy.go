@@ -42,7 +42,7 @@ func cmdProxy(c *cli.Context) error {
 	}
 	dryRun := os.Getenv("ASSH_DRYRUN") == "1"
 
-	conf, err := config.Open(c.GlobalString("config"))
+	conf, err := config.OpenCached(c.GlobalString("config"))
 	if err != nil {
 		Logger.Fatalf("Cannot open configuration file: %v", err)
 	}
@@ -53,6 +53,13 @@ func cmdProxy(c *cli.Context) error {
 
 	target := c.Args()[0]
 
+	// the host is computed first, so the errors of the configuration are
+	// reported before the known hosts or ~/.ssh/config are updated
+	host, err := computeHost(target, c.Int("port"), conf)
+	if err != nil {
+		Logger.Fatalf("Cannot get host '%s': %v", target, err)
+	}
+
 	isOutdated, err := conf.IsConfigOutdated(target)
 	if err != nil {
 		Logger.Warnf("Cannot check if ~/.ssh/config is outdated.")
@@ -69,10 +76,11 @@ func cmdProxy(c *cli.Context) error {
 
 	// FIXME: handle complete host with json
 
-	host, err := computeHost(target, c.Int("port"), conf)
-	if err != nil {
-		Logger.Fatalf("Cannot get host '%s': %v", target, err)
+	detector := config.NewLocationDetector()
+	if err = applyLocation(host, detector, dryRun); err != nil {
+		Logger.Fatalf("Cannot select location of '%s': %v", target, err)
 	}
+
 	w := Logger.Writer()
 	host.WriteSSHConfigTo(w)
 	w.Close()
@@ -84,7 +92,7 @@ func cmdProxy(c *cli.Context) error {
 	Logger.Debugf("Host: %s", hostJSON)
 
 	Logger.Debugf("Proxying")
-	err = proxy(host, conf, dryRun)
+	err = proxy(host, conf, detector, dryRun)
 	if err != nil {
 		Logger.Fatalf("Proxy error: %v", err)
 	}
@@ -93,7 +101,13 @@ func cmdProxy(c *cli.Context) error {
 }
 
 func computeHost(dest string, portOverride int, conf *config.Config) (*config.Host, error) {
-	host := conf.GetHostSafe(dest)
+	host, matches, err := conf.GetConnectHost(dest)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		Logger.Debugf("Applying 'Match %s'", match.Criteria())
+	}
 
 	if portOverride > 0 {
 		host.Port = strconv.Itoa(portOverride)
@@ -102,8 +116,38 @@ func computeHost(dest string, portOverride int, conf *config.Config) (*config.Ho
 	return host, nil
 }
 
+// applyLocation replaces the gateways of the host by the ones of the first
+// matching location, the detector evaluates each condition once for the
+// target and its gateways
+func applyLocation(host *config.Host, detector *config.LocationDetector, dryRun bool) error {
+	if len(host.Locations) == 0 {
+		return nil
+	}
+
+	location, reason, err := host.SelectLocation(detector)
+	if err != nil {
+		return err
+	}
+
+	var message string
+	if location == nil {
+		message = fmt.Sprintf("No location of '%s' matched, using gateways %s", host.Name(), host.Gateways)
+	} else {
+		host.Gateways = location.Gateways
+		message = fmt.Sprintf("Location '%s' of '%s' matched (%s), using gateways %s", location, host.Name(), reason, host.Gateways)
+	}
+
+	if dryRun {
+		Logger.Warnf("dry-run: %s", message)
+	} else {
+		Logger.Infof("%s", message)
+	}
+	return nil
+}
+
 func prepareHostControlPath(host, gateway *config.Host) error {
-	controlPathDir := path.Dir(os.ExpandEnv(strings.Replace(host.ControlPath, "~", "$HOME", -1)))
+	controlPath := host.ExpandString(host.ControlPath)
+	controlPathDir := path.Dir(os.ExpandEnv(strings.Replace(controlPath, "~", "$HOME", -1)))
 	gatewayControlPath := path.Join(controlPathDir, gateway.Name())
 	if config.BoolVal(host.ControlMasterMkdir) {
 		return os.MkdirAll(gatewayControlPath, 0700)
@@ -111,7 +155,9 @@ func prepareHostControlPath(host, gateway *config.Host) error {
 	return nil
 }
 
-func proxy(host *config.Host, conf *config.Config, dryRun bool) error {
+// proxy connects to the host through the first available gateway, the
+// locations of the gateways are evaluated with the detector of the host
+func proxy(host *config.Host, conf *config.Config, detector *config.LocationDetector, dryRun bool) error {
 	if len(host.Gateways) > 0 {
 		Logger.Debugf("Trying gateways: %s", host.Gateways)
 		for _, gateway := range host.Gateways {
@@ -122,9 +168,15 @@ func proxy(host *config.Host, conf *config.Config, dryRun bool) error {
 				}
 			} else {
 				hostCopy := host.Clone()
-				gatewayHost := conf.GetGatewaySafe(gateway)
+				gatewayHost, err := conf.GetGatewaySafe(gateway)
+				if err != nil {
+					return fmt.Errorf("gateway '%s': %v", gateway, err)
+				}
+				if err = applyLocation(gatewayHost, detector, dryRun); err != nil {
+					return fmt.Errorf("gateway '%s': %v", gateway, err)
+				}
 
-				err := prepareHostControlPath(hostCopy, gatewayHost)
+				err = prepareHostControlPath(hostCopy, gatewayHost)
 				if err != nil {
 					return err
 				}
@@ -140,10 +192,11 @@ func proxy(host *config.Host, conf *config.Config, dryRun bool) error {
 					return err
 				}
 
+				// the command is expanded again with the gateway host by proxyCommand
 				if hostCopy.ProxyCommand != "" {
-					command = "ssh %name -- " + hostCopy.ExpandString(hostCopy.ProxyCommand)
+					command = "ssh %name -- " + config.EscapeTokens(hostCopy.ExpandString(hostCopy.ProxyCommand))
 				} else {
-					command = hostCopy.ExpandString("ssh -W %h:%p ") + "%name"
+					command = config.EscapeTokens(hostCopy.ExpandString("ssh -W %h:%p ")) + "%name"
 				}
 
 				Logger.Debugf("Using gateway '%s': %s", gateway, command)
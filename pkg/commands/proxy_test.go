@@ -105,3 +105,78 @@ func Test_hostPrepare(t *testing.T) {
 		So(host.HostName, ShouldEqual, "42.42.42.42")
 	})
 }
+
+const circularConfigExample string = `
+hosts:
+  "*.corp":
+    Inherits: a
+  target:
+    Gateways: [gw.corp]
+templates:
+  a:
+    Inherits: b
+  b:
+    Inherits: a
+`
+
+func Test_proxy(t *testing.T) {
+	Convey("Testing proxy()", t, func() {
+		conf := config.New()
+		So(conf.LoadConfig(strings.NewReader(circularConfigExample)), ShouldBeNil)
+
+		Convey("with a circular inheritance in the target", func() {
+			host, err := computeHost("x.corp", 0, conf)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "circular inheritance: a -> b -> a")
+			So(host, ShouldBeNil)
+		})
+
+		Convey("with a circular inheritance in a gateway", func() {
+			host, err := computeHost("target", 0, conf)
+			So(err, ShouldBeNil)
+
+			err = proxy(host, conf, config.NewLocationDetector(), true)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "gateway 'gw.corp': circular inheritance: a -> b -> a")
+		})
+
+		Convey("with an undefined variable in a gateway", func() {
+			conf := config.New()
+			So(conf.LoadConfig(strings.NewReader(`
+hosts:
+  gw:
+    User: "{{ .Vars.gwuser }}"
+  target:
+    Gateways: [gw]
+`)), ShouldBeNil)
+
+			host, err := computeHost("target", 0, conf)
+			So(err, ShouldBeNil)
+
+			err = proxy(host, conf, config.NewLocationDetector(), true)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `gateway 'gw': host "gw": undefined variable "gwuser" in User`)
+		})
+
+		Convey("with the locations of a gateway", func() {
+			conf := config.New()
+			So(conf.LoadConfig(strings.NewReader(`
+hosts:
+  gw:
+    Locations:
+    - Name: office
+      Route: not-an-address
+      Gateways: direct
+  target:
+    Gateways: [gw]
+`)), ShouldBeNil)
+
+			host, err := computeHost("target", 0, conf)
+			So(err, ShouldBeNil)
+
+			err = proxy(host, conf, config.NewLocationDetector(), true)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `gateway 'gw': location "office": invalid route address "not-an-address"`)
+		})
+	})
+}
@@ -0,0 +1,20 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdSchema(c *cli.Context) error {
+	out, err := json.MarshalIndent(config.JSONSchema(), "", "  ")
+	if err != nil {
+		Logger.Fatalf("Cannot generate the JSON Schema: %v", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
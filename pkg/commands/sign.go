@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+func cmdSign(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		Logger.Fatalf("assh: \"config sign\" requires at least 1 argument. See 'assh config sign --help'.")
+	}
+
+	privateKey := signingKey(c.String("key"))
+	for _, arg := range c.Args() {
+		path, err := utils.ExpandUser(arg)
+		if err != nil {
+			Logger.Fatalf("Cannot expand %q: %v", arg, err)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			Logger.Fatalf("Cannot read %q: %v", arg, err)
+		}
+		if err := ioutil.WriteFile(config.SignatureFile(path), config.Sign(content, privateKey), 0644); err != nil {
+			Logger.Fatalf("Cannot write the signature of %q: %v", arg, err)
+		}
+		Logger.Infof("Signed %s (%s)", arg, config.SignatureFile(arg))
+	}
+	return nil
+}
+
+// signingKey loads the ed25519 private key file, generating the file if it
+// does not exist
+func signingKey(keyFile string) ed25519.PrivateKey {
+	privateKey, err := config.LoadSigningKey(keyFile)
+	if err == nil {
+		return privateKey
+	}
+	if !os.IsNotExist(err) {
+		Logger.Fatalf("Cannot read the key: %v", err)
+	}
+
+	if _, err = config.GenerateSigningKeyFile(keyFile); err != nil {
+		Logger.Fatalf("Cannot generate the key: %v", err)
+	}
+	if privateKey, err = config.LoadSigningKey(keyFile); err != nil {
+		Logger.Fatalf("Cannot read the key: %v", err)
+	}
+	Logger.Infof("Generated %s, add its public key %s to the TrustedKeys of the configurations loading the signed files", keyFile, base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)))
+	return privateKey
+}
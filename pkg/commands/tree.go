@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdTree(c *cli.Context) error {
+	conf, err := config.Open(c.GlobalString("config"))
+	if err != nil {
+		Logger.Fatalf("Cannot open configuration file: %v", err)
+	}
+
+	topology := conf.Topology()
+	switch format := c.String("format"); format {
+	case "ascii":
+		err = topology.WriteASCIITo(os.Stdout)
+	case "dot":
+		err = topology.WriteDOTTo(os.Stdout)
+	case "json":
+		var out []byte
+		out, err = json.MarshalIndent(topology, "", "  ")
+		if err == nil {
+			fmt.Println(string(out))
+		}
+	default:
+		Logger.Fatalf("Unknown format %q, supported formats: ascii, dot, json", format)
+	}
+	if err != nil {
+		Logger.Fatalf("Cannot render the tree: %v", err)
+	}
+
+	return nil
+}
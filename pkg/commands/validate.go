@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdValidate(c *cli.Context) error {
+	// the files are loaded leniently, so broken files are diagnosed instead of aborting
+	conf := config.New()
+	if err := conf.LoadFiles(c.GlobalString("config")); err != nil {
+		Logger.Fatalf("Cannot load configuration: %v", err)
+	}
+
+	diagnostics := conf.Validate()
+	for _, diagnostic := range diagnostics {
+		fmt.Println(diagnostic.String())
+	}
+
+	if diagnostics.HasErrors() {
+		Logger.Fatalf("Invalid configuration (%d issues found)", len(diagnostics))
+	}
+	if len(diagnostics) == 0 {
+		fmt.Println("Configuration is valid.")
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/config"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+)
+
+func cmdWatch(c *cli.Context) error {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	watcher := config.NewWatcher(c.GlobalString("config"))
+	watcher.Delay = c.Duration("delay")
+	if err := watcher.Run(stop); err != nil {
+		Logger.Fatalf("Cannot watch the configuration: %v", err)
+	}
+	return nil
+}
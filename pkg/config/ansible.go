@@ -0,0 +1,442 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	RegisterInventoryProvider("ansible", newAnsibleInventoryProvider)
+}
+
+// ansibleInventoryProvider reads an Ansible inventory file in the INI or YAML
+// format, hosts become assh hosts and groups become templates
+type ansibleInventoryProvider struct {
+	path   string
+	format string
+}
+
+func newAnsibleInventoryProvider(include Include) (InventoryProvider, error) {
+	path, err := include.Path("path")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing path parameter")
+	}
+
+	format := strings.ToLower(include.Param("format"))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yml", ".yaml", ".json":
+			format = "yaml"
+		default:
+			format = "ini"
+		}
+	}
+	if format != "ini" && format != "yaml" {
+		return nil, fmt.Errorf("unknown ansible inventory format %q", format)
+	}
+	return &ansibleInventoryProvider{path: path, format: format}, nil
+}
+
+// Local implements the LocalInventoryProvider interface
+func (p *ansibleInventoryProvider) Local() bool { return true }
+
+func (p *ansibleInventoryProvider) Fetch() ([]byte, error) {
+	return ioutil.ReadFile(p.path)
+}
+
+func (p *ansibleInventoryProvider) Parse(raw []byte) (*Inventory, error) {
+	inventory := newAnsibleInventory()
+	var err error
+	if p.format == "yaml" {
+		err = inventory.parseYAML(raw)
+	} else {
+		err = inventory.parseINI(raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p.path, err)
+	}
+	return inventory.toInventory(), nil
+}
+
+type ansibleGroup struct {
+	vars    map[string]string
+	parents []string
+}
+
+type ansibleHost struct {
+	vars   map[string]string
+	groups []string
+}
+
+type ansibleInventory struct {
+	groups      map[string]*ansibleGroup
+	groupsOrder []string
+	hosts       map[string]*ansibleHost
+	hostsOrder  []string
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		groups: make(map[string]*ansibleGroup),
+		hosts:  make(map[string]*ansibleHost),
+	}
+}
+
+func (i *ansibleInventory) group(name string) *ansibleGroup {
+	group, found := i.groups[name]
+	if !found {
+		group = &ansibleGroup{vars: make(map[string]string)}
+		i.groups[name] = group
+		i.groupsOrder = append(i.groupsOrder, name)
+	}
+	return group
+}
+
+func (i *ansibleInventory) addHost(name, group string, vars map[string]string) {
+	host, found := i.hosts[name]
+	if !found {
+		host = &ansibleHost{vars: make(map[string]string)}
+		i.hosts[name] = host
+		i.hostsOrder = append(i.hostsOrder, name)
+	}
+	i.group(group)
+	if !stringInSlice(group, host.groups) {
+		host.groups = append(host.groups, group)
+	}
+	for key, value := range vars {
+		host.vars[key] = value
+	}
+}
+
+func (i *ansibleInventory) addChild(parent, child string) {
+	i.group(parent)
+	group := i.group(child)
+	if !stringInSlice(parent, group.parents) {
+		group.parents = append(group.parents, parent)
+	}
+}
+
+var ansibleSectionRegex = regexp.MustCompile(`^\[([^:\]]+)(?::(vars|children))?\]$`)
+
+// parseINI parses the INI inventory format:
+// https://docs.ansible.com/ansible/latest/user_guide/intro_inventory.html
+func (i *ansibleInventory) parseINI(raw []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	group, kind := "ungrouped", ""
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			match := ansibleSectionRegex.FindStringSubmatch(line)
+			if match == nil {
+				return fmt.Errorf("line %d: invalid section %q", lineno, line)
+			}
+			group, kind = match[1], match[2]
+			i.group(group)
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("line %d: expected key=value, got %q", lineno, line)
+			}
+			i.group(group).vars[strings.TrimSpace(parts[0])] = unquote(strings.TrimSpace(parts[1]))
+		case "children":
+			i.addChild(group, line)
+		default:
+			args, err := splitQuoted(line, `"'`)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", lineno, err)
+			}
+			vars := map[string]string{}
+			for _, arg := range args[1:] {
+				parts := strings.SplitN(arg, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("line %d: expected key=value, got %q", lineno, arg)
+				}
+				vars[parts[0]] = parts[1]
+			}
+			names, err := expandAnsibleHostPattern(args[0])
+			if err != nil {
+				return fmt.Errorf("line %d: %v", lineno, err)
+			}
+			for _, name := range names {
+				i.addHost(name, group, vars)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// parseYAML parses the YAML inventory format where top-level keys are groups
+// containing `hosts`, `vars` and `children` sections
+func (i *ansibleInventory) parseYAML(raw []byte) error {
+	var groups yaml.MapSlice
+	if err := yaml.Unmarshal(raw, &groups); err != nil {
+		return err
+	}
+	for _, item := range groups {
+		if err := i.parseYAMLGroup(fmt.Sprintf("%v", item.Key), item.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *ansibleInventory) parseYAMLGroup(name string, value interface{}) error {
+	group := i.group(name)
+	if value == nil {
+		return nil
+	}
+	sections, ok := value.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("group %q: expected a mapping", name)
+	}
+
+	for _, section := range sections {
+		entries, _ := section.Value.(yaml.MapSlice)
+		switch key := fmt.Sprintf("%v", section.Key); key {
+		case "hosts":
+			for _, entry := range entries {
+				vars := ansibleYAMLVars(entry.Value)
+				names, err := expandAnsibleHostPattern(fmt.Sprintf("%v", entry.Key))
+				if err != nil {
+					return fmt.Errorf("group %q: %v", name, err)
+				}
+				for _, hostName := range names {
+					i.addHost(hostName, name, vars)
+				}
+			}
+		case "vars":
+			for key, value := range ansibleYAMLVars(section.Value) {
+				group.vars[key] = value
+			}
+		case "children":
+			for _, entry := range entries {
+				child := fmt.Sprintf("%v", entry.Key)
+				i.addChild(name, child)
+				if err := i.parseYAMLGroup(child, entry.Value); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("group %q: unknown key %q", name, key)
+		}
+	}
+	return nil
+}
+
+func ansibleYAMLVars(value interface{}) map[string]string {
+	vars := map[string]string{}
+	entries, _ := value.(yaml.MapSlice)
+	for _, entry := range entries {
+		if entry.Value == nil {
+			continue
+		}
+		vars[fmt.Sprintf("%v", entry.Key)] = fmt.Sprintf("%v", entry.Value)
+	}
+	return vars
+}
+
+var ansibleRangeRegex = regexp.MustCompile(`\[([0-9]+|[a-z]):([0-9]+|[a-z])(?::([0-9]+))?\]`)
+
+// expandAnsibleHostPattern expands the `www[01:50].example.com` and `db-[a:f]` ranges
+func expandAnsibleHostPattern(pattern string) ([]string, error) {
+	match := ansibleRangeRegex.FindStringSubmatchIndex(pattern)
+	if match == nil {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:match[0]], pattern[match[1]:]
+	start, end := pattern[match[2]:match[3]], pattern[match[4]:match[5]]
+	step := 1
+	if match[6] >= 0 {
+		step, _ = strconv.Atoi(pattern[match[6]:match[7]])
+		if step < 1 {
+			return nil, fmt.Errorf("invalid range step in %q", pattern)
+		}
+	}
+
+	values := []string{}
+	first, errFirst := strconv.Atoi(start)
+	last, errLast := strconv.Atoi(end)
+	switch {
+	case errFirst == nil && errLast == nil:
+		format := "%d"
+		if len(start) > 1 && start[0] == '0' {
+			format = fmt.Sprintf("%%0%dd", len(start))
+		}
+		for value := first; value <= last; value += step {
+			values = append(values, fmt.Sprintf(format, value))
+		}
+	case errFirst != nil && errLast != nil:
+		for value := start[0]; value <= end[0]; value += byte(step) {
+			values = append(values, string(value))
+		}
+	default:
+		return nil, fmt.Errorf("invalid range in %q", pattern)
+	}
+
+	names := []string{}
+	for _, value := range values {
+		// the suffix may contain other ranges
+		expanded, err := expandAnsibleHostPattern(prefix + value + suffix)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, expanded...)
+	}
+	return names, nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// toInventory converts the ansible hosts and groups into assh hosts and
+// templates, empty `all` and `ungrouped` groups are skipped
+func (i *ansibleInventory) toInventory() *Inventory {
+	inventory := &Inventory{
+		Hosts:     make(HostsMap),
+		Templates: make(HostsMap),
+	}
+
+	emitted := map[string]bool{}
+	for name, group := range i.groups {
+		emitted[name] = (name != "all" && name != "ungrouped") || len(group.vars) > 0
+	}
+	inherits := func(groups []string) composeyaml.Stringorslice {
+		ret := composeyaml.Stringorslice{}
+		for _, group := range groups {
+			if emitted[group] {
+				ret = append(ret, group)
+			}
+		}
+		return ret
+	}
+
+	for _, name := range i.groupsOrder {
+		if !emitted[name] {
+			continue
+		}
+		group := i.groups[name]
+		template := NewHost(name)
+		applyAnsibleVars(template, group.vars)
+		parents := group.parents
+		if len(parents) == 0 && name != "all" {
+			parents = []string{"all"}
+		}
+		template.Inherits = inherits(parents)
+		inventory.Templates[name] = template
+	}
+
+	for _, name := range i.hostsOrder {
+		host := NewHost(name)
+		applyAnsibleVars(host, i.hosts[name].vars)
+		groups := i.hosts[name].groups
+		if len(groups) == 1 && groups[0] == "ungrouped" {
+			groups = append(groups, "all")
+		}
+		host.Inherits = inherits(groups)
+		inventory.Hosts[name] = host
+	}
+	return inventory
+}
+
+// ansibleVars are the ansible connection variables mapped to Host fields, in
+// the order they are applied: like with the ssh connection plugin of ansible,
+// the ansible_ssh_* variants override the short names
+var ansibleVars = []struct {
+	name  string
+	apply func(host *Host, value string)
+}{
+	{"ansible_host", func(host *Host, value string) { host.HostName = value }},
+	{"ansible_ssh_host", func(host *Host, value string) { host.HostName = value }},
+	{"ansible_user", func(host *Host, value string) { host.User = value }},
+	{"ansible_ssh_user", func(host *Host, value string) { host.User = value }},
+	{"ansible_port", func(host *Host, value string) { host.Port = value }},
+	{"ansible_ssh_port", func(host *Host, value string) { host.Port = value }},
+	{"ansible_ssh_private_key_file", func(host *Host, value string) { host.IdentityFile = composeyaml.Stringorslice{value} }},
+	{"ansible_ssh_common_args", applyAnsibleSSHArgs},
+	{"ansible_ssh_extra_args", applyAnsibleSSHArgs},
+}
+
+func applyAnsibleSSHArgs(host *Host, value string) {
+	if gateway := sshArgsToGateway(value); gateway != "" {
+		host.Gateways = composeyaml.Stringorslice{gateway}
+	}
+}
+
+// applyAnsibleVars maps the ansible connection variables to Host fields
+func applyAnsibleVars(host *Host, vars map[string]string) {
+	for _, variable := range ansibleVars {
+		if value, found := vars[variable.name]; found {
+			variable.apply(host, value)
+		}
+	}
+}
+
+// sshArgsToGateway returns the gateway configured by `-J`, `-o ProxyJump` or
+// `-o ProxyCommand` in ssh command line arguments
+func sshArgsToGateway(value string) string {
+	args, err := splitQuoted(value, `"'`)
+	if err != nil {
+		return ""
+	}
+
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+		option := ""
+		switch {
+		case arg == "-J" && idx+1 < len(args):
+			idx++
+			option = "proxyjump=" + args[idx]
+		case strings.HasPrefix(arg, "-J"):
+			option = "proxyjump=" + arg[2:]
+		case arg == "-o" && idx+1 < len(args):
+			idx++
+			option = args[idx]
+		case strings.HasPrefix(arg, "-o"):
+			option = arg[2:]
+		default:
+			continue
+		}
+
+		keyword, optionValue, optionArgs, err := splitSSHConfigLine(option)
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(keyword) {
+		case "proxyjump":
+			if gateway, err := proxyJumpToGateway(optionValue); err == nil {
+				return gateway
+			}
+		case "proxycommand":
+			if gateway, err := proxyCommandToGateway(optionArgs); err == nil && gateway != "" {
+				return gateway
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAnsibleInventoryProvider(t *testing.T) {
+	Convey("Testing the ansible inventory provider", t, FailureContinues, func() {
+		Convey("INI format", func() {
+			provider := &ansibleInventoryProvider{format: "ini"}
+			inventory, err := provider.Parse([]byte(`# comment
+standalone ansible_host=1.2.3.4
+
+[web]
+web[01:02].example.com ansible_user=deploy
+legacy ansible_host=10.0.0.9 ansible_port=2222 ansible_ssh_common_args='-o ProxyCommand="ssh -W %h:%p -q bastion"'
+
+[web:vars]
+ansible_ssh_common_args="-J bastion"
+
+[prod:children]
+web
+
+[prod:vars]
+ansible_user = admin
+`))
+			So(err, ShouldBeNil)
+			So(len(inventory.Hosts), ShouldEqual, 4)
+
+			So(inventory.Hosts["standalone"].HostName, ShouldEqual, "1.2.3.4")
+			So(inventory.Hosts["standalone"].Inherits, ShouldResemble, composeyaml.Stringorslice{})
+
+			So(inventory.Hosts["web01.example.com"].User, ShouldEqual, "deploy")
+			So(inventory.Hosts["web01.example.com"].Inherits, ShouldResemble, composeyaml.Stringorslice{"web"})
+			So(inventory.Hosts["web02.example.com"], ShouldNotBeNil)
+
+			So(inventory.Hosts["legacy"].HostName, ShouldEqual, "10.0.0.9")
+			So(inventory.Hosts["legacy"].Port, ShouldEqual, "2222")
+			So(inventory.Hosts["legacy"].Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+
+			So(len(inventory.Templates), ShouldEqual, 2)
+			So(inventory.Templates["web"].Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+			So(inventory.Templates["web"].Inherits, ShouldResemble, composeyaml.Stringorslice{"prod"})
+			So(inventory.Templates["prod"].User, ShouldEqual, "admin")
+		})
+
+		Convey("YAML format", func() {
+			provider := &ansibleInventoryProvider{format: "yaml"}
+			inventory, err := provider.Parse([]byte(`all:
+  vars:
+    ansible_user: root
+  hosts:
+    mail.example.com:
+  children:
+    databases:
+      hosts:
+        db-[a:b].example.com:
+          ansible_port: 5022
+      vars:
+        ansible_ssh_common_args: -o ProxyJump=gw2,gw1
+`))
+			So(err, ShouldBeNil)
+			So(len(inventory.Hosts), ShouldEqual, 3)
+			So(inventory.Hosts["mail.example.com"].Inherits, ShouldResemble, composeyaml.Stringorslice{"all"})
+			So(inventory.Hosts["db-a.example.com"].Port, ShouldEqual, "5022")
+			So(inventory.Hosts["db-b.example.com"].Inherits, ShouldResemble, composeyaml.Stringorslice{"databases"})
+
+			So(len(inventory.Templates), ShouldEqual, 2)
+			So(inventory.Templates["all"].User, ShouldEqual, "root")
+			So(inventory.Templates["all"].Inherits, ShouldResemble, composeyaml.Stringorslice{})
+			So(inventory.Templates["databases"].Gateways, ShouldResemble, composeyaml.Stringorslice{"gw1/gw2"})
+			So(inventory.Templates["databases"].Inherits, ShouldResemble, composeyaml.Stringorslice{"all"})
+		})
+
+		Convey("Invalid inventory", func() {
+			provider := &ansibleInventoryProvider{path: "hosts", format: "ini"}
+			_, err := provider.Parse([]byte("[web\nfoo\n"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `hosts: line 1: invalid section "[web"`)
+		})
+
+		Convey("Include from assh.yml", func() {
+			dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			So(ioutil.WriteFile(filepath.Join(dir, "hosts.ini"), []byte(`[web]
+web1 ansible_host=10.0.0.1
+
+[web:vars]
+ansible_user=deploy
+`), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte(`includes:
+- provider: ansible
+  path: hosts.ini
+`), 0644), ShouldBeNil)
+
+			config := New()
+			So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+			host, err := config.GetHost("web1")
+			So(err, ShouldBeNil)
+			So(host.HostName, ShouldEqual, "10.0.0.1")
+			So(host.User, ShouldEqual, "deploy")
+		})
+	})
+}
+
+func TestExpandAnsibleHostPattern(t *testing.T) {
+	Convey("Testing expandAnsibleHostPattern()", t, FailureContinues, func() {
+		names, err := expandAnsibleHostPattern("www[08:10:2].example.com")
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"www08.example.com", "www10.example.com"})
+
+		names, err = expandAnsibleHostPattern("db[1:2]-[a:b]")
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"db1-a", "db1-b", "db2-a", "db2-b"})
+
+		_, err = expandAnsibleHostPattern("db[1:b]")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestApplyAnsibleVars(t *testing.T) {
+	Convey("Testing applyAnsibleVars()", t, FailureContinues, func() {
+		host := NewHost("legacy")
+		applyAnsibleVars(host, map[string]string{
+			"ansible_host":     "10.0.0.1",
+			"ansible_ssh_host": "10.0.0.2",
+			"ansible_user":     "deploy",
+			"ansible_ssh_user": "legacy",
+			"ansible_port":     "2222",
+			"ansible_ssh_port": "2200",
+		})
+		// the ansible_ssh_* variants override the short names
+		So(host.HostName, ShouldEqual, "10.0.0.2")
+		So(host.User, ShouldEqual, "legacy")
+		So(host.Port, ShouldEqual, "2200")
+
+		host = NewHost("modern")
+		applyAnsibleVars(host, map[string]string{
+			"ansible_user": "deploy",
+			"ansible_port": "2222",
+		})
+		So(host.User, ShouldEqual, "deploy")
+		So(host.Port, ShouldEqual, "2222")
+	})
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+	"github.com/noqqe/advanced-ssh-config/pkg/version"
+)
+
+// compiledCacheDir is the directory of the compiled configurations, it is a
+// variable so it can be overridden in the tests
+var compiledCacheDir = "~/.ssh/assh_compiled_cache"
+
+// compiledFormat is increased when the content of the compiled configurations changes
+const compiledFormat = 1
+
+func init() {
+	// the types of the parameters of the inventory includes
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// fileStamp is the state of a file a compiled configuration depends on
+type fileStamp struct {
+	Path    string
+	Size    int64
+	ModTime int64
+	Missing bool
+}
+
+func stampFile(path string) fileStamp {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{Path: path, Missing: true}
+	}
+	return fileStamp{Path: path, Size: stat.Size(), ModTime: stat.ModTime().UnixNano()}
+}
+
+// compiledKey describes the inputs of a compiled configuration, it is
+// written before the configuration so it can be checked without decoding it
+type compiledKey struct {
+	Format  int
+	Version string
+	Binary  fileStamp
+	// Files are the states of the files before they were read, a file
+	// changed while the configuration was loaded invalidates it
+	Files []fileStamp
+	// Patterns are the include patterns and the files they matched
+	Patterns map[string][]string
+	// Expiry is when the first cached inventory expires
+	Expiry time.Time
+	// Dir is the working directory when relative paths were loaded
+	Dir string
+}
+
+// outdated returns why the compiled configuration cannot be used, or an empty string
+func (k *compiledKey) outdated() string {
+	switch {
+	case k.Format != compiledFormat || k.Version != version.VERSION:
+		return "assh was upgraded"
+	case k.Binary != binaryStamp():
+		return "the assh binary changed"
+	case !k.Expiry.IsZero() && time.Now().After(k.Expiry):
+		return "an inventory expired"
+	case k.Dir != "" && k.Dir != workingDir():
+		return "relative paths were loaded from another directory"
+	}
+	for _, stamp := range k.Files {
+		if stampFile(stamp.Path) != stamp {
+			return fmt.Sprintf("%s changed", stamp.Path)
+		}
+	}
+	for pattern, files := range k.Patterns {
+		matches, _ := filepath.Glob(pattern)
+		if !stringSlicesEqual(matches, files) {
+			return fmt.Sprintf("the files matching %s changed", pattern)
+		}
+	}
+	return ""
+}
+
+func binaryStamp() fileStamp {
+	path, err := os.Executable()
+	if err != nil {
+		return fileStamp{Missing: true}
+	}
+	return stampFile(path)
+}
+
+// configFields has the exported fields of Config, gob ignores the others
+type configFields Config
+
+// compiledConfig is the state of a loaded configuration
+type compiledConfig struct {
+	Config          *configFields
+	IncludedFiles   map[string]bool
+	IncludePatterns map[string][]string
+	HostsOrder      map[string]int
+	TemplatesOrder  map[string]int
+	Redefinitions   Diagnostics
+	Untrusted       Diagnostics
+}
+
+func (c *Config) compiled() compiledConfig {
+	return compiledConfig{
+		Config:          (*configFields)(c),
+		IncludedFiles:   c.includedFiles,
+		IncludePatterns: c.includePatterns,
+		HostsOrder:      c.hostsOrder,
+		TemplatesOrder:  c.templatesOrder,
+		Redefinitions:   c.redefinitions,
+		Untrusted:       c.untrusted,
+	}
+}
+
+// compiledKey returns the key of the configuration
+func (c *Config) compiledKey() compiledKey {
+	files := []string{}
+	for file := range c.stamps {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	key := compiledKey{
+		Format:   compiledFormat,
+		Version:  version.VERSION,
+		Binary:   binaryStamp(),
+		Patterns: c.includePatterns,
+		Expiry:   c.cacheExpiry,
+	}
+	for _, file := range files {
+		key.Files = append(key.Files, c.stamps[file])
+		if !filepath.IsAbs(file) {
+			key.Dir = workingDir()
+		}
+	}
+	for pattern := range c.includePatterns {
+		if !filepath.IsAbs(pattern) {
+			key.Dir = workingDir()
+		}
+	}
+	return key
+}
+
+func workingDir() string {
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// compiledCachePath returns the path of the compiled configuration of a configuration file
+func compiledCachePath(path string) (string, error) {
+	dir, err := utils.ExpandUser(compiledCacheDir)
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum([]byte(path))
+	return filepath.Join(dir, hex.EncodeToString(hash[:])+".gob"), nil
+}
+
+// saveCompiled writes the compiled configuration, readable by the user only
+func (c *Config) saveCompiled(cachePath string) error {
+	if c.volatile {
+		return fmt.Errorf("the configuration uses encrypted files or uncached inventories")
+	}
+	key := c.compiledKey()
+
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	if err := encoder.Encode(&key); err != nil {
+		return err
+	}
+	compiled := c.compiled()
+	if err := encoder.Encode(&compiled); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(cachePath, buf.Bytes(), 0600)
+}
+
+// loadCompiled reads a compiled configuration if its inputs did not change
+func loadCompiled(cachePath string) (*Config, error) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	var key compiledKey
+	if err = decoder.Decode(&key); err != nil {
+		return nil, err
+	}
+	if reason := key.outdated(); reason != "" {
+		return nil, fmt.Errorf("outdated: %s", reason)
+	}
+
+	// the values are decoded in the maps of a new configuration, gob does
+	// not send the empty ones
+	config := New()
+	compiled := config.compiled()
+	if err = decoder.Decode(&compiled); err != nil {
+		return nil, err
+	}
+	config.redefinitions = compiled.Redefinitions
+	config.untrusted = compiled.Untrusted
+	config.cacheExpiry = key.Expiry
+	for _, stamp := range key.Files {
+		config.stamps[stamp.Path] = stamp
+	}
+	config.applyMissingNames()
+	return config, nil
+}
+
+// OpenCached is Open using a compiled version of the configuration when the
+// configuration files, the files matching the include patterns, the cached
+// inventories and assh did not change since it was written
+func OpenCached(path string) (*Config, error) {
+	expanded, err := utils.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	if expanded, err = filepath.Abs(expanded); err != nil {
+		return nil, err
+	}
+	cachePath, err := compiledCachePath(expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := loadCompiled(cachePath)
+	if err != nil {
+		Logger.Debugf("Cannot use the compiled configuration %q: %v", cachePath, err)
+		config = New()
+		if err = config.LoadFile(path); err != nil {
+			return nil, err
+		}
+		if err = config.saveCompiled(cachePath); err != nil {
+			Logger.Debugf("Cannot compile the configuration: %v", err)
+		}
+	} else {
+		Logger.Debugf("Using the compiled configuration %q", cachePath)
+	}
+
+	if asshProfile != "" {
+		if err := config.ApplyProfile(asshProfile); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpenCached(t *testing.T) {
+	Convey("Testing OpenCached()", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		oldCompiledCacheDir := compiledCacheDir
+		defer func() { compiledCacheDir = oldCompiledCacheDir }()
+		compiledCacheDir = filepath.Join(dir, "cache")
+
+		mainPath := filepath.Join(dir, "assh.yml")
+		So(ioutil.WriteFile(mainPath, []byte(`defaults:
+  User: admin
+templates:
+  web:
+    Port: 2222
+hosts:
+  "*.corp":
+    Gateways: [jump]
+  jump:
+    HostName: jump.corp
+profiles:
+  travel:
+    hosts:
+      jump:
+        HostName: 1.2.3.4
+matches:
+- user: root
+  options:
+    ForwardAgent: no
+includes:
+- `+filepath.Join(dir, "assh.d", "*.yml")+`
+- provider: ansible
+  path: `+filepath.Join(dir, "inventory.ini")+`
+`), 0644), ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(dir, "assh.d"), 0700), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "web.yml"), []byte("hosts:\n  web-1:\n    Inherits: [web]\n  jump:\n    User: jumper\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "inventory.ini"), []byte("[db]\ndb-1 ansible_host=10.0.0.1\n"), 0644), ShouldBeNil)
+
+		cachePath, err := compiledCachePath(mainPath)
+		So(err, ShouldBeNil)
+
+		fresh, err := Open(mainPath)
+		So(err, ShouldBeNil)
+		_, err = loadCompiled(cachePath)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		config, err := OpenCached(mainPath)
+		So(err, ShouldBeNil)
+		info, err := os.Stat(cachePath)
+		So(err, ShouldBeNil)
+		So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+		compiled, err := loadCompiled(cachePath)
+		So(err, ShouldBeNil)
+		for _, loaded := range []*Config{config, compiled} {
+			expected, err := fresh.JsonString()
+			So(err, ShouldBeNil)
+			actual, err := loaded.JsonString()
+			So(err, ShouldBeNil)
+			So(string(actual), ShouldEqual, string(expected))
+			So(loaded.hostsOrder, ShouldResemble, fresh.hostsOrder)
+			So(loaded.Redefinitions(), ShouldResemble, fresh.Redefinitions())
+
+			host, err := loaded.GetHost("db-1")
+			So(err, ShouldBeNil)
+			So(host.HostName, ShouldEqual, "10.0.0.1")
+			host, err = loaded.GetHost("web-1")
+			So(err, ShouldBeNil)
+			So(host.Port, ShouldEqual, "2222")
+			So(host.User, ShouldEqual, "admin")
+		}
+		So(compiled.Hosts["jump"].name, ShouldEqual, "jump")
+		So(compiled.Templates["web"].isTemplate, ShouldBeTrue)
+		So(compiled.Defaults.isDefault, ShouldBeTrue)
+		So(compiled.ApplyProfile("travel"), ShouldBeNil)
+		So(compiled.Hosts["jump"].HostName, ShouldEqual, "1.2.3.4")
+
+		Convey("invalidated by a modified file", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "web.yml"), []byte("hosts:\n  web-2:\n    Inherits: [web]\n"), 0644), ShouldBeNil)
+			_, err := loadCompiled(cachePath)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "web.yml changed")
+
+			config, err := OpenCached(mainPath)
+			So(err, ShouldBeNil)
+			So(config.sortedNames(), ShouldContain, "web-2")
+			_, err = loadCompiled(cachePath)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("invalidated by a new file matching an include pattern", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "db.yml"), []byte("hosts:\n  db-2: {}\n"), 0644), ShouldBeNil)
+			_, err := loadCompiled(cachePath)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "the files matching")
+
+			config, err := OpenCached(mainPath)
+			So(err, ShouldBeNil)
+			So(config.sortedNames(), ShouldContain, "db-2")
+		})
+
+		Convey("invalidated by a modified inventory", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "inventory.ini"), []byte("[db]\ndb-1 ansible_host=10.0.0.2\n"), 0644), ShouldBeNil)
+			config, err := OpenCached(mainPath)
+			So(err, ShouldBeNil)
+			host, err := config.GetHost("db-1")
+			So(err, ShouldBeNil)
+			So(host.HostName, ShouldEqual, "10.0.0.2")
+		})
+
+		Convey("with a corrupted compiled configuration", func() {
+			So(ioutil.WriteFile(cachePath, []byte("garbage"), 0600), ShouldBeNil)
+			config, err := OpenCached(mainPath)
+			So(err, ShouldBeNil)
+			So(config.sortedNames(), ShouldContain, "web-1")
+			_, err = loadCompiled(cachePath)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("never compiled with encrypted files", func() {
+			encrypted, err := EncryptWithPassphrase([]byte("hosts:\n  secret: {}\n"), FormatYAML, []byte("s3cr3t"))
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "secret.yml"), encrypted, 0644), ShouldBeNil)
+			oldReadPassphrase := ReadPassphrase
+			defer func() { ReadPassphrase = oldReadPassphrase }()
+			ReadPassphrase = func(prompt string) ([]byte, error) { return []byte("s3cr3t"), nil }
+
+			So(os.Remove(cachePath), ShouldBeNil)
+			config, err := OpenCached(mainPath)
+			So(err, ShouldBeNil)
+			So(config.sortedNames(), ShouldContain, "secret")
+			_, err = os.Stat(cachePath)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+// writeBenchmarkConfig writes a configuration of files included files with
+// hostsPerFile hosts each
+func writeBenchmarkConfig(b *testing.B, dir string, files, hostsPerFile int) string {
+	if err := os.MkdirAll(filepath.Join(dir, "assh.d"), 0700); err != nil {
+		b.Fatal(err)
+	}
+	for file := 0; file < files; file++ {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "templates:\n  tpl-%d:\n    User: user-%d\n    Port: 22%02d\nhosts:\n", file, file, file)
+		for host := 0; host < hostsPerFile; host++ {
+			fmt.Fprintf(&content, "  host-%d-%d:\n    HostName: 10.%d.%d.1\n    Inherits: [tpl-%d]\n    Gateways: [direct, jump-%d]\n", file, host, file, host%256, file, file)
+		}
+		fmt.Fprintf(&content, "  \"*.zone-%d\":\n    ProxyCommand: nc %%h %%p\n", file)
+		if err := ioutil.WriteFile(filepath.Join(dir, "assh.d", fmt.Sprintf("%02d.yml", file)), []byte(content.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	mainPath := filepath.Join(dir, "assh.yml")
+	content := "defaults:\n  ControlMaster: auto\nincludes:\n- " + filepath.Join(dir, "assh.d", "*.yml") + "\n"
+	if err := ioutil.WriteFile(mainPath, []byte(content), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return mainPath
+}
+
+func benchmarkOpen(b *testing.B, open func(string) (*Config, error)) {
+	dir, err := ioutil.TempDir(os.TempDir(), "assh-benchmarks")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldCompiledCacheDir := compiledCacheDir
+	defer func() { compiledCacheDir = oldCompiledCacheDir }()
+	compiledCacheDir = filepath.Join(dir, "cache")
+
+	mainPath := writeBenchmarkConfig(b, dir, 40, 100)
+	if _, err := open(mainPath); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config, err := open(mainPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := config.GetHost("host-39-99"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	benchmarkOpen(b, Open)
+}
+
+func BenchmarkOpenCached(b *testing.B) {
+	benchmarkOpen(b, OpenCached)
+}
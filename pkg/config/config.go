@@ -2,6 +2,7 @@ package config
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,10 +14,13 @@ import (
 	"strings"
 	"time"
 
+	composeyaml "github.com/docker/libcompose/yaml"
+
 	"github.com/noqqe/advanced-ssh-config/pkg/flexyaml"
 	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
 	"github.com/noqqe/advanced-ssh-config/pkg/utils"
 	"github.com/noqqe/advanced-ssh-config/pkg/version"
+	"gopkg.in/yaml.v2"
 )
 
 var asshBinaryPath = "assh"
@@ -25,15 +29,39 @@ const defaultSshConfigPath = "~/.ssh/config"
 
 // Config contains a list of Hosts sections and a Defaults section representing a configuration file
 type Config struct {
-	Hosts             HostsMap `yaml:"hosts,omitempty,flow" json:"hosts"`
-	Templates         HostsMap `yaml:"templates,omitempty,flow" json:"templates"`
-	Defaults          Host     `yaml:"defaults,omitempty,flow" json:"defaults,omitempty"`
-	Includes          []string `yaml:"includes,omitempty,flow" json:"includes,omitempty"`
-	ASSHKnownHostFile string   `yaml:"asshknownhostfile,omitempty,flow" json:"asshknownhostfile,omitempty"`
-	ASSHBinaryPath    string   `yaml:"asshbinarypath,omitempty,flow" json:"asshbinarypath,omitempty"`
-
-	includedFiles map[string]bool
-	sshConfigPath string
+	Hosts             HostsMap                  `yaml:"hosts,omitempty,flow" json:"hosts"`
+	Templates         HostsMap                  `yaml:"templates,omitempty,flow" json:"templates"`
+	Defaults          Host                      `yaml:"defaults,omitempty,flow" json:"defaults,omitempty"`
+	Includes          []Include                 `yaml:"includes,omitempty,flow" json:"includes,omitempty"`
+	Profiles          map[string]*Profile       `yaml:"profiles,omitempty,flow" json:"profiles,omitempty"`
+	Vars              map[string]string         `yaml:"vars,omitempty,flow" json:"vars,omitempty"`
+	Matches           []MatchBlock              `yaml:"matches,omitempty,flow" json:"matches,omitempty"`
+	ASSHKnownHostFile string                    `yaml:"asshknownhostfile,omitempty,flow" json:"asshknownhostfile,omitempty"`
+	ASSHBinaryPath    string                    `yaml:"asshbinarypath,omitempty,flow" json:"asshbinarypath,omitempty"`
+	SSHConfigDir      string                    `yaml:"sshconfigdir,omitempty,flow" json:"sshconfigdir,omitempty"`
+	EncryptionKey     string                    `yaml:"encryptionkey,omitempty,flow" json:"encryptionkey,omitempty"`
+	TrustedKeys       composeyaml.Stringorslice `yaml:"trustedkeys,omitempty,flow" json:"trustedkeys,omitempty"`
+	UntrustedIncludes string                    `yaml:"untrustedincludes,omitempty,flow" json:"untrustedincludes,omitempty"`
+	Origins           Origins                   `yaml:"-" json:"origins,omitempty"`
+
+	includedFiles     map[string]bool
+	includePatterns   map[string][]string
+	sshConfigPath     string
+	hostsOrder        map[string]int
+	templatesOrder    map[string]int
+	redefinitions     Diagnostics
+	inventoryCacheDir string
+	activeProfile     string
+	passphrase        []byte
+	untrusted         Diagnostics
+
+	// stamps are the states of the files read by the configuration, taken
+	// before reading them; cacheExpiry is when the first cached inventory
+	// expires; the volatile configurations (decrypted files, inventories
+	// without cache) are never compiled
+	stamps      map[string]fileStamp
+	cacheExpiry time.Time
+	volatile    bool
 }
 
 // SetASSHBinaryPath sets the default assh binary path
@@ -49,8 +77,10 @@ func (c *Config) String() string {
 }
 
 // SaveNewKnownHost registers the target as a new known host and save the full known hosts list on disk
-func (c *Config) SaveNewKnownHost(target string) {
-	c.addKnownHost(target)
+func (c *Config) SaveNewKnownHost(target string) error {
+	if err := c.addKnownHost(target); err != nil {
+		return err
+	}
 
 	path, err := utils.ExpandUser(c.ASSHKnownHostFile)
 	if err != nil {
@@ -60,19 +90,23 @@ func (c *Config) SaveNewKnownHost(target string) {
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
 	if err != nil {
 		Logger.Errorf("Cannot append host %q to %q (performance degradation): %v", target, c.ASSHKnownHostFile, err)
-		return
+		return nil
 	}
 
 	fmt.Fprintln(file, target)
 
-	file.Close()
+	return file.Close()
 }
 
-func (c *Config) addKnownHost(target string) {
-	host := c.GetHostSafe(target)
+func (c *Config) addKnownHost(target string) error {
+	host, err := c.GetHostSafe(target)
+	if err != nil {
+		return err
+	}
 	if inst, ok := c.Hosts[host.pattern]; ok {
 		inst.AddKnownHost(target)
 	}
+	return nil
 }
 
 // LoadKnownHosts loads known hosts list from disk
@@ -90,7 +124,9 @@ func (c *Config) LoadKnownHosts() error {
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		c.addKnownHost(scanner.Text())
+		if err := c.addKnownHost(scanner.Text()); err != nil {
+			return err
+		}
 	}
 
 	return scanner.Err()
@@ -110,6 +146,112 @@ func (c *Config) JsonString() ([]byte, error) {
 	return json.MarshalIndent(c, "", "  ")
 }
 
+// YamlString returns a string representing the YAML of a Config object
+func (c *Config) YamlString() ([]byte, error) {
+	// the yaml struct tags are flow-styled and lowercased, going through
+	// JSON produces a block-styled output using the documented key names
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(buf, &generic); err != nil {
+		return nil, err
+	}
+	for key, value := range generic {
+		if section, ok := value.(map[string]interface{}); ok && len(section) == 0 {
+			delete(generic, key)
+		}
+	}
+	return yaml.Marshal(generic)
+}
+
+// inheritanceResolver resolves the Inherits of a host depth-first, computing
+// each inherited host only once and keeping track of the current inheritance
+// path to detect cycles
+type inheritanceResolver struct {
+	config   *Config
+	resolved map[string]*Host
+	path     []string
+}
+
+func newInheritanceResolver(config *Config) *inheritanceResolver {
+	return &inheritanceResolver{
+		config:   config,
+		resolved: make(map[string]*Host),
+	}
+}
+
+// apply merges the inherited hosts in declaration order, every inherited host
+// being fully resolved before being merged, so the closest definition wins
+func (r *inheritanceResolver) apply(host *Host, key string) error {
+	r.path = append(r.path, key)
+	defer func() { r.path = r.path[:len(r.path)-1] }()
+
+	for _, name := range host.Inherits {
+		if name == key {
+			Logger.Debugf("Host %q inherits from itself, skipping...", key)
+			continue
+		}
+		for idx, ancestor := range r.path {
+			if ancestor == name {
+				cycle := append(append([]string{}, r.path[idx:]...), name)
+				return fmt.Errorf("circular inheritance: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		if _, found := host.inherited[name]; found {
+			continue
+		}
+
+		target, err := r.resolve(name)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			continue
+		}
+
+		for inherited := range target.inherited {
+			host.inherited[inherited] = true
+		}
+		host.inherited[name] = true
+		host.ApplyDefaults(target)
+	}
+	return nil
+}
+
+// resolve returns a copy of the host matching the path with its own
+// inheritances applied, or nil if there is no such host
+func (r *inheritanceResolver) resolve(path string) (*Host, error) {
+	if host, ok := r.resolved[path]; ok {
+		return host, nil
+	}
+
+	parts := strings.SplitN(path, "/", 2)
+	target, err := r.config.matchHost(parts[0], true)
+	if err == nil && target == nil {
+		err = fmt.Errorf("no such host: %s", parts[0])
+	}
+	if err != nil {
+		Logger.Warnf("Cannot inherits from %q: %v", path, err)
+		r.resolved[path] = nil
+		return nil, nil
+	}
+
+	host := target.Clone()
+	host.name = parts[0]
+	host.inherited = map[string]bool{parts[0]: true}
+	if len(parts) > 1 {
+		host.Gateways = []string{parts[1]}
+	}
+
+	if err := r.apply(host, path); err != nil {
+		return nil, err
+	}
+	r.resolved[path] = host
+	return host, nil
+}
+
 // computeHost returns a copy of the host with applied defaults, resolved inheritances and configured internal fields
 func computeHost(host *Host, config *Config, name string, fullCompute bool) (*Host, error) {
 	computedHost := NewHost(name)
@@ -125,86 +267,75 @@ func computeHost(host *Host, config *Config, name string, fullCompute bool) (*Ho
 	computedHost.inherited[name] = true
 
 	// Inheritance
-	// FIXME: allow deeper inheritance:
-	//     currently not resolving inherited hosts
-	//     we should resolve all inherited hosts and pass the
-	//     currently resolved hosts to avoid computing an host twice
-	for _, name := range host.Inherits {
-		_, found := computedHost.inherited[name]
-		if found {
-			Logger.Debugf("Detected circular loop inheritance, skiping...")
-			continue
-		}
-		computedHost.inherited[name] = true
-
-		target, err := config.getHostByPath(name, false, false, true)
-		if err != nil {
-			Logger.Warnf("Cannot inherits from %q: %v", name, err)
-			continue
-		}
-		computedHost.ApplyDefaults(target)
+	key := computedHost.pattern
+	if key == "" {
+		key = name
+	}
+	if err := newInheritanceResolver(config).apply(computedHost, key); err != nil {
+		return nil, err
 	}
 
 	// fullCompute applies config.Defaults
 	// config.Defaults should be applied when proxying
 	// but should not when exporting .ssh/config file
 	if fullCompute {
-		// apply defaults based on "Host *"
-		computedHost.ApplyDefaults(&config.Defaults)
+		finalizeHost(computedHost, config, name)
+	}
 
-		if computedHost.HostName == "" {
-			computedHost.HostName = name
-		}
-		// expands variables in host
-		// i.e: %h.some.zone -> {name}.some.zone
-		hostname := strings.Replace(computedHost.HostName, "%h", "%n", -1)
-
-		// ssh resolve '%h' in hostnames
-		// -> we bypass the string expansion if the input matches
-		//    an already resolved hostname
-		// See https://github.com/noqqe/advanced-ssh-config/issues/103
-		pattern := strings.Replace(hostname, "%n", "*", -1)
-		if match, _ := path.Match(pattern, computedHost.inputName); match {
-			computedHost.HostName = computedHost.inputName
-		} else {
-			computedHost.HostName = computedHost.ExpandString(hostname)
-		}
+	// user-defined variables
+	if err := renderVars(computedHost, config.hostVars(computedHost)); err != nil {
+		return nil, fmt.Errorf("host %q: %v", name, err)
 	}
 
 	return computedHost, nil
 }
 
-func (c *Config) getHostByName(name string, safe bool, compute bool, allowTemplate bool) (*Host, error) {
-	if host, ok := c.Hosts[name]; ok {
-		Logger.Debugf("getHostByName direct matching: %q", name)
-		return computeHost(host, c, name, compute)
+// finalizeHost applies config.Defaults and resolves the HostName
+func finalizeHost(computedHost *Host, config *Config, name string) {
+	// apply defaults based on "Host *"
+	computedHost.ApplyDefaults(&config.Defaults)
+
+	if computedHost.HostName == "" {
+		computedHost.HostName = name
 	}
+	// expands variables in host
+	// i.e: %h.some.zone -> {name}.some.zone
+	hostname := strings.Replace(computedHost.HostName, "%h", "%n", -1)
 
-	for origPattern, host := range c.Hosts {
-		patterns := append([]string{origPattern}, host.Aliases...)
-		for _, pattern := range patterns {
+	// ssh resolve '%h' in hostnames
+	// -> we bypass the string expansion if the input matches
+	//    an already resolved hostname
+	// See https://github.com/noqqe/advanced-ssh-config/issues/103
+	pattern := strings.Replace(hostname, "%n", "*", -1)
+	if match, _ := path.Match(pattern, computedHost.inputName); match {
+		computedHost.HostName = computedHost.inputName
+	} else {
+		computedHost.HostName = computedHost.ExpandString(hostname)
+	}
+}
 
-			matched, err := path.Match(pattern, name)
-			if err != nil {
-				return nil, err
-			}
-			if matched {
-				Logger.Debugf("getHostByName pattern matching: %q => %q", pattern, name)
-				return computeHost(host, c, name, compute)
-			}
-		}
+// matchHost returns the raw host definition matching name with the highest
+// precedence, or nil if there is none
+func (c *Config) matchHost(name string, allowTemplate bool) (*Host, error) {
+	matches, err := c.candidates(name, allowTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil
 	}
 
-	if allowTemplate {
-		for pattern, template := range c.Templates {
-			matched, err := path.Match(pattern, name)
-			if err != nil {
-				return nil, err
-			}
-			if matched {
-				return computeHost(template, c, name, compute)
-			}
-		}
+	Logger.Debugf("getHostByName %s matching: %q => %q", matches[0].KindString(), matches[0].Pattern, name)
+	return matches[0].host, nil
+}
+
+func (c *Config) getHostByName(name string, safe bool, compute bool, allowTemplate bool) (*Host, error) {
+	host, err := c.matchHost(name, allowTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if host != nil {
+		return computeHost(host, c, name, compute)
 	}
 
 	if safe {
@@ -232,12 +363,8 @@ func (c *Config) getHostByPath(path string, safe bool, compute bool, allowTempla
 }
 
 // GetGatewaySafe returns gateway Host configuration, a gateway is like a Host, except, the host path is not resolved
-func (c *Config) GetGatewaySafe(name string) *Host {
-	host, err := c.getHostByName(name, true, true, false) // FIXME: fullCompute for gateway ?
-	if err != nil {
-		panic(err)
-	}
-	return host
+func (c *Config) GetGatewaySafe(name string) (*Host, error) {
+	return c.getHostByName(name, true, true, false) // FIXME: fullCompute for gateway ?
 }
 
 // GetHost returns a matching host form Config hosts list
@@ -245,19 +372,22 @@ func (c *Config) GetHost(name string) (*Host, error) {
 	return c.getHostByPath(name, false, true, false)
 }
 
-// GetHostSafe won't fail, in case the host is not found, it will returns a virtual host matching the pattern
-func (c *Config) GetHostSafe(name string) *Host {
-	host, err := c.getHostByPath(name, true, true, false)
-	if err != nil {
-		panic(err)
-	}
-	return host
+// GetHostSafe won't fail if the host is not found, it will returns a virtual
+// host matching the pattern; only the errors of the configuration (circular
+// inheritance, undefined variables) are returned
+func (c *Config) GetHostSafe(name string) (*Host, error) {
+	return c.getHostByPath(name, true, true, false)
 }
 
 // isSSHConfigOutdated returns true if assh.yml or an included file has a
-// modification date more recent than .ssh/config
+// modification date more recent than .ssh/config (or the SSHConfigDir
+// directory, touched on each build)
 func (c *Config) isSSHConfigOutdated() (bool, error) {
-	filepath, err := utils.ExpandUser(c.sshConfigPath)
+	generatedPath := c.sshConfigPath
+	if c.SSHConfigDir != "" {
+		generatedPath = c.SSHConfigDir
+	}
+	filepath, err := utils.ExpandUser(generatedPath)
 	if err != nil {
 		return false, err
 	}
@@ -287,7 +417,9 @@ func (c *Config) IsConfigOutdated(target string) (bool, error) {
 	// check if the target is a regex and if the pattern
 	// was never matched before (not in known hosts)
 	if c.needsARebuildForTarget(target) {
-		c.SaveNewKnownHost(target)
+		if err := c.SaveNewKnownHost(target); err != nil {
+			return false, err
+		}
 		return true, nil
 	}
 
@@ -344,16 +476,57 @@ func (c *Config) needsARebuildForTarget(target string) bool {
 
 // LoadConfig loads the content of an io.Reader source
 func (c *Config) LoadConfig(source io.Reader) error {
+	return c.loadConfig(source, "", false)
+}
+
+// loadConfig loads a configuration, without the options running commands if strip is true
+func (c *Config) loadConfig(source io.Reader, filename string, strip bool) error {
 	buf, err := ioutil.ReadAll(source)
 	if err != nil {
 		return err
 	}
-	err = flexyaml.Unmarshal(buf, &c)
+	format := DetectFormat(filename, buf)
+	if IsEncrypted(buf) {
+		if buf, format, err = c.decryptConfig(buf, filename); err != nil {
+			return err
+		}
+		// the decrypted content is never written to the disk
+		c.volatile = true
+	}
+	if buf, err = configToYAML(buf, format); err != nil {
+		return err
+	}
+	// the lines of the JSON, TOML and stripped files do not match the YAML document
+	trackLines := format == FormatYAML
+	if strip {
+		var removed []string
+		if buf, removed, err = stripExecutable(buf); err != nil {
+			return err
+		}
+		if len(removed) > 0 {
+			Logger.Warnf("Ignoring %s from the untrusted %s", strings.Join(removed, ", "), filename)
+		}
+		trackLines = false
+	}
+	doc, err := flexyaml.Parse(buf)
+	if err != nil {
+		return err
+	}
+	previous := c.snapshotDefinitions()
+	// the matches and includes of every file are kept, in loading order
+	matches, includes := c.Matches, c.Includes
+	c.Matches, c.Includes = nil, nil
+	err = doc.Decode(&c)
+	c.Matches = append(matches, c.Matches...)
+	c.Includes = append(includes, c.Includes...)
 	if err != nil {
 		return err
 	}
 	c.applyMissingNames()
-	return nil
+	if err = c.checkProfileNames(); err != nil {
+		return err
+	}
+	return c.recordOrigins(doc, filename, trackLines, previous)
 }
 
 func (c *Config) applyMissingNames() {
@@ -377,7 +550,8 @@ func (c *Config) applyMissingNames() {
 	c.Defaults.isDefault = true
 }
 
-// SaveSSHConfig saves the configuration to ~/.ssh/config
+// SaveSSHConfig saves the configuration to the section of ~/.ssh/config
+// delimited by the `# BEGIN assh` and `# END assh` markers
 func (c *Config) SaveSSHConfig() error {
 	if c.sshConfigPath == "" {
 		return fmt.Errorf("no Config.sshConfigPath configured")
@@ -386,13 +560,37 @@ func (c *Config) SaveSSHConfig() error {
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(filepath)
-	if err != nil {
+
+	var generated bytes.Buffer
+	if c.SSHConfigDir != "" {
+		dir, err := c.saveSSHConfigDir()
+		if err != nil {
+			return err
+		}
+		// `Match all` ends a Host block written before the section
+		fmt.Fprintf(&generated, "Match all\nInclude %s\n", path.Join(dir, "*.conf"))
+	} else if err = c.WriteSSHConfigTo(&generated); err != nil {
 		return err
 	}
-	defer file.Close()
+
+	existing, err := ioutil.ReadFile(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	content, edited, err := MergeManagedSection(existing, generated.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s: %v", filepath, err)
+	}
+	if edited {
+		Logger.Warnf("The assh section of %q was edited manually, the changes are overwritten", filepath)
+	}
+
+	if bytes.Equal(content, existing) {
+		return nil
+	}
 	Logger.Debugf("Writing SSH config file to %q", filepath)
-	return c.WriteSSHConfigTo(file)
+	// ssh may be reading the file while it is rebuilt
+	return utils.WriteFileAtomic(filepath, content, 0644)
 }
 
 // LoadFile loads the content of a configuration file in the Config object
@@ -414,13 +612,28 @@ func (c *Config) LoadFile(filename string) error {
 	Logger.Debugf("Loading config file '%s'", filepath)
 
 	// Read file
-	source, err := os.Open(filepath)
+	c.stamps[filepath] = stampFile(filepath)
+	content, err := ioutil.ReadFile(filepath)
 	if err != nil {
 		return err
 	}
 
+	// Once trusted keys are configured, the next files must be signed
+	strip := false
+	if len(c.TrustedKeys) > 0 {
+		if err = c.verifyInclude(filepath, content); err != nil {
+			if c.untrustedIncludesPolicy() == UntrustedIncludesRefuse {
+				c.untrusted = append(c.untrusted, Diagnostic{File: filepath, Severity: SeverityError, Message: fmt.Sprintf("untrusted include refused: %v", err)})
+				return fmt.Errorf("untrusted include: %v", err)
+			}
+			c.untrusted = append(c.untrusted, Diagnostic{File: filepath, Severity: SeverityWarning, Message: fmt.Sprintf("untrusted include loaded without its executable options: %v", err)})
+			strip = true
+		}
+	}
+
 	// Load config stream
-	err = c.LoadConfig(source)
+	declared := len(c.Includes)
+	err = c.loadConfig(bytes.NewReader(content), filepath, strip)
 	if err != nil {
 		return err
 	}
@@ -431,9 +644,19 @@ func (c *Config) LoadFile(filename string) error {
 	diffHostsCount := afterHostsCount - beforeHostsCount
 	Logger.Debugf("Loaded config file '%s' (%d + %d => %d hosts)", filepath, beforeHostsCount, afterHostsCount, diffHostsCount)
 
-	// Handling includes
-	for _, include := range c.Includes {
-		if err = c.LoadFiles(include); err != nil {
+	// Handling the includes declared by this file
+	includes := c.Includes[declared:]
+	for idx := range includes {
+		includes[idx].dir = path.Dir(filepath)
+	}
+	for _, include := range includes {
+		if include.Provider != "" {
+			if err = c.LoadInventory(include); err != nil {
+				Logger.Warnf("Cannot include %q: %v", include, err)
+			}
+			continue
+		}
+		if err = c.LoadFiles(include.Pattern); err != nil {
 			return err
 		}
 	}
@@ -454,6 +677,9 @@ func (c *Config) LoadFiles(pattern string) error {
 	if err != nil {
 		return err
 	}
+	// the files matching the pattern later are picked up by `assh config
+	// watch` and invalidate the compiled configuration
+	c.includePatterns[expandedPattern] = filepaths
 
 	// Load files iteratively
 	for _, filepath := range filepaths {
@@ -490,36 +716,73 @@ func (c *Config) WriteSSHConfigTo(w io.Writer) error {
 #
 # more info: https://github.com/noqqe/advanced-ssh-config
 `)
+	if c.activeProfile != "" {
+		header += fmt.Sprintf("\n# profile: %s", c.activeProfile)
+	}
 	header = strings.Replace(header, "%VERSION", version.VERSION, -1)
 	header = strings.Replace(header, "%BUILD_DATE", time.Now().Format("2006-01-02 15:04:05 -0700 MST"), -1)
 	fmt.Fprintln(w, header)
 	// FIXME: add version
 	fmt.Fprintln(w)
 
+	if c.hasMatchBlocks(MatchPositionBefore) {
+		fmt.Fprintln(w, "# match-based configuration, before the hosts")
+		if err := c.writeMatchBlocks(w, MatchPositionBefore); err != nil {
+			return err
+		}
+	}
+
 	fmt.Fprintln(w, "# host-based configuration")
 	for _, name := range c.sortedNames() {
-		host := c.Hosts[name]
-		computedHost, err := computeHost(host, c, name, false)
-		if err != nil {
+		if err := c.writeHostTo(w, name); err != nil {
+			return err
+		}
+	}
+
+	if c.hasMatchBlocks(MatchPositionAfter) {
+		fmt.Fprintln(w, "# match-based configuration")
+		if err := c.writeMatchBlocks(w, MatchPositionAfter); err != nil {
 			return err
 		}
-		computedHost.WriteSSHConfigTo(w)
-		fmt.Fprintln(w)
 	}
 
 	fmt.Fprintln(w, "# global configuration")
-	c.Defaults.name = "*"
-	c.Defaults.WriteSSHConfigTo(w)
+	return c.writeDefaultsTo(w)
+}
 
+// writeHostTo writes the Host blocks of a host
+func (c *Config) writeHostTo(w io.Writer, name string) error {
+	computedHost, err := computeHost(c.Hosts[name], c, name, false)
+	if err != nil {
+		return err
+	}
+	computedHost.WriteSSHConfigTo(w)
+	fmt.Fprintln(w)
 	return nil
 }
 
+// writeDefaultsTo writes the `Host *` block
+func (c *Config) writeDefaultsTo(w io.Writer) error {
+	c.Defaults.name = "*"
+	defaults := c.Defaults
+	if err := renderVars(&defaults, c.hostVars(&defaults)); err != nil {
+		return fmt.Errorf("defaults: %v", err)
+	}
+	return defaults.WriteSSHConfigTo(w)
+}
+
 // New returns an instantiated Config object
 func New() *Config {
 	var config Config
 	config.Hosts = make(map[string]*Host)
 	config.Templates = make(map[string]*Host)
 	config.includedFiles = make(map[string]bool)
+	config.includePatterns = make(map[string][]string)
+	config.stamps = make(map[string]fileStamp)
+	config.hostsOrder = make(map[string]int)
+	config.templatesOrder = make(map[string]int)
+	config.Origins = make(Origins)
+	config.inventoryCacheDir = defaultInventoryCacheDir
 	config.sshConfigPath = defaultSshConfigPath
 	config.ASSHKnownHostFile = "~/.ssh/assh_known_hosts"
 	config.ASSHBinaryPath = ""
@@ -533,5 +796,10 @@ func Open(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if asshProfile != "" {
+		if err := config.ApplyProfile(asshProfile); err != nil {
+			return nil, err
+		}
+	}
 	return config, nil
 }
@@ -848,29 +848,36 @@ func TestConfig_GetGatewaySafe(t *testing.T) {
 
 		config := dummyConfig()
 		var host *Host
+		var err error
 
 		Convey("Without gateway", func() {
-			host = config.GetGatewaySafe("titi")
+			host, err = config.GetGatewaySafe("titi")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "titi")
 
-			host = config.GetGatewaySafe("dontexists")
+			host, err = config.GetGatewaySafe("dontexists")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "dontexists")
 
-			host = config.GetGatewaySafe("regex.ddd")
+			host, err = config.GetGatewaySafe("regex.ddd")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "regex.ddd")
 			So(host.HostName, ShouldEqual, "1.3.5.7")
 		})
 
 		Convey("With gateway", func() {
-			host = config.GetGatewaySafe("titi/gateway")
+			host, err = config.GetGatewaySafe("titi/gateway")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "titi/gateway")
 			So(len(host.Gateways), ShouldEqual, 0)
 
-			host = config.GetGatewaySafe("dontexists/gateway")
+			host, err = config.GetGatewaySafe("dontexists/gateway")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "dontexists/gateway")
 			So(len(host.Gateways), ShouldEqual, 0)
 
-			host = config.GetGatewaySafe("regex.ddd/gateway")
+			host, err = config.GetGatewaySafe("regex.ddd/gateway")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "regex.ddd/gateway")
 			So(host.HostName, ShouldNotEqual, "1.3.5.7")
 			So(len(host.Gateways), ShouldEqual, 0)
@@ -1129,10 +1136,11 @@ func TestConfig_GetHost(t *testing.T) {
 			host, err = config.GetHost("tata")
 			So(err, ShouldBeNil)
 			So(host.inherited, ShouldResemble, map[string]bool{
-				"tata": true,
-				"tutu": true,
-				"titi": true,
-				"toto": true,
+				"tata":  true,
+				"tutu":  true,
+				"titi":  true,
+				"toto":  true,
+				"*.ddd": true,
 			})
 			So(host.ProxyCommand, ShouldEqual, "nc -v 4242")
 			So(host.User, ShouldEqual, "moul")
@@ -1153,14 +1161,57 @@ func TestConfig_GetHost(t *testing.T) {
 			host, err = config.GetHost("nnn")
 			So(err, ShouldBeNil)
 			So(host.inherited, ShouldResemble, map[string]bool{
-				"nnn": true,
-				"mmm": true,
+				"nnn":   true,
+				"mmm":   true,
+				"tata":  true,
+				"tutu":  true,
+				"titi":  true,
+				"toto":  true,
+				"*.ddd": true,
 			})
 			So(host.User, ShouldEqual, "mmmm")
 			So(host.Port, ShouldEqual, "26")
 			So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"titi", "direct", "1.2.3.4"})
 		})
 
+		Convey("Deep inheritance", FailureContinues, func() {
+			config := New()
+			config.Templates["base"] = &Host{User: "base", Port: "2222", Compression: "yes"}
+			config.Templates["team"] = &Host{User: "team", Inherits: []string{"base"}}
+			config.Templates["env"] = &Host{Inherits: []string{"team"}, Gateways: []string{"bastion"}}
+			config.Templates["other"] = &Host{User: "other", ForwardAgent: "yes"}
+			config.Hosts["host"] = &Host{Inherits: []string{"env", "other"}}
+			config.applyMissingNames()
+
+			host, err = config.GetHost("host")
+			So(err, ShouldBeNil)
+			So(host.inherited, ShouldResemble, map[string]bool{
+				"host":  true,
+				"env":   true,
+				"team":  true,
+				"base":  true,
+				"other": true,
+			})
+			So(host.User, ShouldEqual, "team")
+			So(host.Port, ShouldEqual, "2222")
+			So(host.Compression, ShouldEqual, "yes")
+			So(host.ForwardAgent, ShouldEqual, "yes")
+			So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+		})
+
+		Convey("Circular inheritance", FailureContinues, func() {
+			config := New()
+			config.Hosts["a"] = &Host{Inherits: []string{"b"}}
+			config.Templates["b"] = &Host{Inherits: []string{"c"}}
+			config.Templates["c"] = &Host{Inherits: []string{"a"}}
+			config.applyMissingNames()
+
+			host, err = config.GetHost("a")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "circular inheritance: a -> b -> c -> a")
+			So(host, ShouldBeNil)
+		})
+
 		Convey("Aliases", FailureContinues, func() {
 			host, err = config.GetHost("ooo1")
 			So(err, ShouldBeNil)
@@ -1207,36 +1258,64 @@ func TestConfig_GetHostSafe(t *testing.T) {
 
 		config := dummyConfig()
 		var host *Host
+		var err error
 
 		Convey("Without gateway", func() {
-			host = config.GetHostSafe("titi")
+			host, err = config.GetHostSafe("titi")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "titi")
 			So(len(host.Gateways), ShouldEqual, 0)
 
-			host = config.GetHostSafe("dontexists")
+			host, err = config.GetHostSafe("dontexists")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "dontexists")
 			So(len(host.Gateways), ShouldEqual, 0)
 
-			host = config.GetHostSafe("regex.ddd")
+			host, err = config.GetHostSafe("regex.ddd")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "regex.ddd")
 			So(host.HostName, ShouldEqual, "1.3.5.7")
 			So(len(host.Gateways), ShouldEqual, 0)
 		})
 
 		Convey("With gateway", func() {
-			host = config.GetHostSafe("titi/gateway")
+			host, err = config.GetHostSafe("titi/gateway")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "titi")
 			So(len(host.Gateways), ShouldEqual, 1)
 
-			host = config.GetHostSafe("dontexists/gateway")
+			host, err = config.GetHostSafe("dontexists/gateway")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "dontexists")
 			So(len(host.Gateways), ShouldEqual, 1)
 
-			host = config.GetHostSafe("regex.ddd/gateway")
+			host, err = config.GetHostSafe("regex.ddd/gateway")
+			So(err, ShouldBeNil)
 			So(host.Name(), ShouldEqual, "regex.ddd")
 			So(host.HostName, ShouldEqual, "1.3.5.7")
 			So(len(host.Gateways), ShouldEqual, 1)
 		})
+
+		Convey("Circular inheritance", func() {
+			config := New()
+			config.Hosts["*.corp"] = &Host{Inherits: []string{"a"}}
+			config.Templates["a"] = &Host{Inherits: []string{"b"}}
+			config.Templates["b"] = &Host{Inherits: []string{"a"}}
+			config.applyMissingNames()
+
+			host, err = config.GetHostSafe("x.corp")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "circular inheritance: a -> b -> a")
+			So(host, ShouldBeNil)
+
+			host, err = config.GetGatewaySafe("x.corp")
+			So(err, ShouldNotBeNil)
+			So(host, ShouldBeNil)
+
+			isOutdated, err := config.IsConfigOutdated("x.corp")
+			So(err, ShouldNotBeNil)
+			So(isOutdated, ShouldBeFalse)
+		})
 	})
 }
 
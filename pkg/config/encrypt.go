@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+// Modes of the encrypted configuration files
+const (
+	EncryptionPassphrase = "passphrase"
+	EncryptionX25519     = "x25519"
+)
+
+// encryptedBlockType is the PEM type of the encrypted files, the headers
+// are the Mode, the Format of the decrypted content and for the x25519 mode
+// the public key of the Recipient
+const encryptedBlockType = "ASSH ENCRYPTED CONFIG"
+
+// DefaultEncryptionKey is the private key decrypting the x25519 files when
+// the configuration does not set EncryptionKey
+const DefaultEncryptionKey = "~/.ssh/assh.key"
+
+// ErrWrongPassphrase is returned when decrypting a file with a wrong passphrase
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// scrypt parameters of the passphrase mode
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ReadPassphrase asks a passphrase on the terminal, ASSH_PASSPHRASE is
+// used when set; it is a variable so it can be overridden in the tests
+var ReadPassphrase = func(prompt string) ([]byte, error) {
+	if passphrase := os.Getenv("ASSH_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	// assh runs as a ProxyCommand, the standard input is the connection
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to ask the passphrase, set ASSH_PASSPHRASE: %v", err)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	defer fmt.Fprintln(tty)
+	return terminal.ReadPassword(int(tty.Fd()))
+}
+
+// IsEncrypted returns true if buf is an encrypted configuration
+func IsEncrypted(buf []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(buf), []byte("-----BEGIN "+encryptedBlockType+"-----"))
+}
+
+// EncryptWithPassphrase encrypts a configuration of the given format with a
+// key derived from the passphrase
+func EncryptWithPassphrase(plaintext []byte, format string, passphrase []byte) ([]byte, error) {
+	var salt [16]byte
+	var nonce [24]byte
+	if err := randomBytes(salt[:], nonce[:]); err != nil {
+		return nil, err
+	}
+	key, err := passphraseKey(passphrase, salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	body := append(salt[:], nonce[:]...)
+	body = secretbox.Seal(body, plaintext, &nonce, key)
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    encryptedBlockType,
+		Headers: map[string]string{"Mode": EncryptionPassphrase, "Format": format},
+		Bytes:   body,
+	}), nil
+}
+
+// EncryptForKey encrypts a configuration of the given format for the owners
+// of the private key of recipient
+func EncryptForKey(plaintext []byte, format string, recipient *[32]byte) ([]byte, error) {
+	ephemeralPublic, ephemeralPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	if err := randomBytes(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	body := append(ephemeralPublic[:], nonce[:]...)
+	body = box.Seal(body, plaintext, &nonce, recipient, ephemeralPrivate)
+	return pem.EncodeToMemory(&pem.Block{
+		Type: encryptedBlockType,
+		Headers: map[string]string{
+			"Mode":      EncryptionX25519,
+			"Format":    format,
+			"Recipient": EncodeKey(recipient),
+		},
+		Bytes: body,
+	}), nil
+}
+
+// Decrypt returns the decrypted content of an encrypted configuration and its
+// format; passphrase is only called for the passphrase mode and keyFile is
+// the private key of the x25519 mode
+func Decrypt(buf []byte, passphrase func() ([]byte, error), keyFile string) ([]byte, string, error) {
+	block, _ := pem.Decode(bytes.TrimSpace(buf))
+	if block == nil || block.Type != encryptedBlockType {
+		return nil, "", fmt.Errorf("not an encrypted configuration")
+	}
+	format := block.Headers["Format"]
+	if format == "" {
+		format = FormatYAML
+	}
+
+	switch mode := block.Headers["Mode"]; mode {
+	case EncryptionPassphrase:
+		if len(block.Bytes) < 16+24+secretbox.Overhead {
+			return nil, "", fmt.Errorf("truncated encrypted configuration")
+		}
+		secret, err := passphrase()
+		if err != nil {
+			return nil, "", err
+		}
+		key, err := passphraseKey(secret, block.Bytes[:16])
+		if err != nil {
+			return nil, "", err
+		}
+		var nonce [24]byte
+		copy(nonce[:], block.Bytes[16:40])
+		plaintext, ok := secretbox.Open(nil, block.Bytes[40:], &nonce, key)
+		if !ok {
+			return nil, "", ErrWrongPassphrase
+		}
+		return plaintext, format, nil
+
+	case EncryptionX25519:
+		if len(block.Bytes) < 32+24+box.Overhead {
+			return nil, "", fmt.Errorf("truncated encrypted configuration")
+		}
+		privateKey, err := LoadPrivateKey(keyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		var ephemeralPublic [32]byte
+		var nonce [24]byte
+		copy(ephemeralPublic[:], block.Bytes[:32])
+		copy(nonce[:], block.Bytes[32:56])
+		plaintext, ok := box.Open(nil, block.Bytes[56:], &nonce, &ephemeralPublic, privateKey)
+		if !ok {
+			return nil, "", fmt.Errorf("%s cannot decrypt the file, it was encrypted for the public key %s", keyFile, block.Headers["Recipient"])
+		}
+		return plaintext, format, nil
+
+	default:
+		return nil, "", fmt.Errorf("unknown encryption mode %q", mode)
+	}
+}
+
+// GenerateKeyFile writes a new X25519 private key to path and returns its public key
+func GenerateKeyFile(path string) (*[32]byte, error) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := utils.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	return publicKey, ioutil.WriteFile(expanded, []byte(EncodeKey(privateKey)+"\n"), 0600)
+}
+
+// LoadPrivateKey reads an X25519 private key written by GenerateKeyFile
+func LoadPrivateKey(path string) (*[32]byte, error) {
+	expanded, err := utils.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecodeKey(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
+
+// PublicKey returns the public key of an X25519 private key
+func PublicKey(privateKey *[32]byte) *[32]byte {
+	var publicKey [32]byte
+	curve25519.ScalarBaseMult(&publicKey, privateKey)
+	return &publicKey
+}
+
+// EncodeKey returns the base64 representation of a key
+func EncodeKey(key *[32]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// DecodeKey parses the base64 representation of a key
+func DecodeKey(encoded string) (*[32]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("invalid key, expected 32 base64-encoded bytes")
+	}
+	var key [32]byte
+	copy(key[:], raw)
+	return &key, nil
+}
+
+func passphraseKey(passphrase, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+func randomBytes(buffers ...[]byte) error {
+	for _, buffer := range buffers {
+		if _, err := io.ReadFull(rand.Reader, buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptConfig decrypts an encrypted file loaded by the configuration, the
+// passphrase is only asked once
+func (c *Config) decryptConfig(buf []byte, filename string) ([]byte, string, error) {
+	passphrase := func() ([]byte, error) {
+		if c.passphrase == nil {
+			secret, err := ReadPassphrase(fmt.Sprintf("Passphrase of %s: ", filename))
+			if err != nil {
+				return nil, err
+			}
+			c.passphrase = secret
+		}
+		return c.passphrase, nil
+	}
+
+	keyFile := c.EncryptionKey
+	if keyFile == "" {
+		keyFile = DefaultEncryptionKey
+	}
+	plaintext, format, err := Decrypt(buf, passphrase, keyFile)
+	if err == ErrWrongPassphrase {
+		// the next file may use another passphrase
+		c.passphrase = nil
+	}
+	return plaintext, format, err
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncryption(t *testing.T) {
+	Convey("Testing the encryption of the configuration files", t, FailureContinues, func() {
+		plaintext := []byte("hosts:\n  secret:\n    HostName: 10.0.0.1\n")
+		passphrase := func(secret string) func() ([]byte, error) {
+			return func() ([]byte, error) { return []byte(secret), nil }
+		}
+
+		Convey("with a passphrase", func() {
+			encrypted, err := EncryptWithPassphrase(plaintext, FormatYAML, []byte("s3cr3t"))
+			So(err, ShouldBeNil)
+			So(IsEncrypted(encrypted), ShouldBeTrue)
+			So(string(encrypted), ShouldNotContainSubstring, "10.0.0.1")
+			So(string(encrypted), ShouldContainSubstring, "Mode: passphrase")
+
+			decrypted, format, err := Decrypt(encrypted, passphrase("s3cr3t"), "")
+			So(err, ShouldBeNil)
+			So(string(decrypted), ShouldEqual, string(plaintext))
+			So(format, ShouldEqual, FormatYAML)
+
+			_, _, err = Decrypt(encrypted, passphrase("wrong"), "")
+			So(err, ShouldEqual, ErrWrongPassphrase)
+		})
+
+		Convey("with an X25519 key", func() {
+			dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			keyFile := filepath.Join(dir, "assh.key")
+			publicKey, err := GenerateKeyFile(keyFile)
+			So(err, ShouldBeNil)
+			privateKey, err := LoadPrivateKey(keyFile)
+			So(err, ShouldBeNil)
+			So(*PublicKey(privateKey), ShouldResemble, *publicKey)
+			info, err := os.Stat(keyFile)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+			encrypted, err := EncryptForKey(plaintext, FormatTOML, publicKey)
+			So(err, ShouldBeNil)
+			So(string(encrypted), ShouldContainSubstring, "Recipient: "+EncodeKey(publicKey))
+
+			noPassphrase := func() ([]byte, error) { return nil, fmt.Errorf("unexpected passphrase") }
+			decrypted, format, err := Decrypt(encrypted, noPassphrase, keyFile)
+			So(err, ShouldBeNil)
+			So(string(decrypted), ShouldEqual, string(plaintext))
+			So(format, ShouldEqual, FormatTOML)
+
+			otherKey := filepath.Join(dir, "other.key")
+			_, err = GenerateKeyFile(otherKey)
+			So(err, ShouldBeNil)
+			_, _, err = Decrypt(encrypted, noPassphrase, otherKey)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "encrypted for the public key "+EncodeKey(publicKey))
+		})
+
+		So(IsEncrypted(plaintext), ShouldBeFalse)
+		_, err := DecodeKey("dG9vIHNob3J0")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestConfig_LoadFile_encrypted(t *testing.T) {
+	Convey("Testing Config.LoadFile() with encrypted includes", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		prompts := 0
+		oldReadPassphrase := ReadPassphrase
+		defer func() { ReadPassphrase = oldReadPassphrase }()
+		ReadPassphrase = func(prompt string) ([]byte, error) {
+			prompts++
+			return []byte("team passphrase"), nil
+		}
+
+		keyFile := filepath.Join(dir, "team.key")
+		publicKey, err := GenerateKeyFile(keyFile)
+		So(err, ShouldBeNil)
+
+		for _, file := range []struct {
+			name      string
+			plaintext string
+			format    string
+		}{
+			{"team.yml.enc", "hosts:\n  jump:\n    HostName: jump.internal\n", FormatYAML},
+			{"ops.enc", `{"hosts": {"ops": {"User": "ops"}}}`, FormatJSON},
+			{"infra.enc", "[hosts.db]\nGateways = \"jump\"\n", FormatTOML},
+		} {
+			var encrypted []byte
+			if file.format == FormatTOML {
+				encrypted, err = EncryptForKey([]byte(file.plaintext), file.format, publicKey)
+			} else {
+				encrypted, err = EncryptWithPassphrase([]byte(file.plaintext), file.format, []byte("team passphrase"))
+			}
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, file.name), encrypted, 0644), ShouldBeNil)
+		}
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte(fmt.Sprintf("EncryptionKey: %s\nincludes:\n- %s\n", keyFile, filepath.Join(dir, "*.enc"))), 0644), ShouldBeNil)
+
+		config := New()
+		So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"db", "jump", "ops"})
+		So(prompts, ShouldEqual, 1)
+
+		host, err := config.GetHost("db")
+		So(err, ShouldBeNil)
+		So([]string(host.Gateways), ShouldResemble, []string{"jump"})
+		So(strings.Join(config.IncludedFiles(), " "), ShouldContainSubstring, "infra.enc")
+
+		So(config.Validate(), ShouldBeEmpty)
+		So(prompts, ShouldEqual, 1)
+
+		Convey("with a wrong passphrase", func() {
+			ReadPassphrase = func(prompt string) ([]byte, error) { return []byte("wrong"), nil }
+			source, err := os.Open(filepath.Join(dir, "ops.enc"))
+			So(err, ShouldBeNil)
+			defer source.Close()
+			So(New().LoadConfig(source), ShouldEqual, ErrWrongPassphrase)
+		})
+	})
+}
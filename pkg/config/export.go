@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Ansible inventory formats
+const (
+	AnsibleFormatINI  = "ini"
+	AnsibleFormatYAML = "yaml"
+)
+
+// ansibleExportHost is a host of an exported inventory
+type ansibleExportHost struct {
+	name   string
+	vars   yaml.MapSlice
+	groups []string
+}
+
+// ansibleExport returns the hosts with their connection variables and the
+// groups (the inherited templates) with their child groups
+func (c *Config) ansibleExport() ([]ansibleExportHost, map[string][]string, error) {
+	hosts := []ansibleExportHost{}
+	children := map[string][]string{}
+
+	templateGroups := func(inherits []string) []string {
+		groups := []string{}
+		for _, name := range inherits {
+			if _, found := c.Templates[name]; found {
+				groups = append(groups, name)
+			}
+		}
+		return groups
+	}
+
+	for name, template := range c.Templates {
+		if _, found := children[name]; !found {
+			children[name] = []string{}
+		}
+		for _, parent := range templateGroups(template.Inherits) {
+			children[parent] = append(children[parent], name)
+		}
+	}
+	for name := range children {
+		sort.Strings(children[name])
+	}
+
+	for _, name := range c.sortedNames() {
+		if IsPattern(name) {
+			continue
+		}
+		host, err := c.GetHost(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		vars := yaml.MapSlice{{Key: "ansible_host", Value: host.HostName}}
+		if host.User != "" {
+			vars = append(vars, yaml.MapItem{Key: "ansible_user", Value: host.User})
+		}
+		if host.Port != "" {
+			vars = append(vars, yaml.MapItem{Key: "ansible_port", Value: host.Port})
+		}
+		if len(host.IdentityFile) > 0 {
+			vars = append(vars, yaml.MapItem{Key: "ansible_ssh_private_key_file", Value: host.IdentityFile[0]})
+		}
+		if args := gatewayToSSHArgs(host.Gateways); args != "" {
+			vars = append(vars, yaml.MapItem{Key: "ansible_ssh_common_args", Value: args})
+		}
+
+		hosts = append(hosts, ansibleExportHost{
+			name:   name,
+			vars:   vars,
+			groups: templateGroups(c.Hosts[name].Inherits),
+		})
+	}
+	return hosts, children, nil
+}
+
+// gatewayToSSHArgs returns the ssh arguments reaching a host through its
+// first gateway, the fallback gateways are not exported. The gateways are
+// reached with their name so ssh uses the configuration generated by assh
+// for them; like with `assh connect`, a gateway path `a/b` is the gateway
+// `a` reached through `b`, written as the `-J b,a` jumps
+func gatewayToSSHArgs(gateways []string) string {
+	if len(gateways) == 0 || gateways[0] == "direct" {
+		return ""
+	}
+
+	hops := []string{}
+	parts := strings.Split(gateways[0], "/")
+	for idx := len(parts) - 1; idx >= 0; idx-- {
+		if parts[idx] != "direct" {
+			hops = append(hops, parts[idx])
+		}
+	}
+	switch len(hops) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf(`-o ProxyCommand="ssh -W %%h:%%p -q %s"`, hops[0])
+	}
+	return "-J " + strings.Join(hops, ",")
+}
+
+// WriteAnsibleInventory writes the hosts as an Ansible inventory in the INI
+// or YAML format, the templates inherited by the hosts become groups
+func (c *Config) WriteAnsibleInventory(w io.Writer, format string) error {
+	hosts, children, err := c.ansibleExport()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case AnsibleFormatINI:
+		return writeAnsibleINI(w, hosts, children)
+	case AnsibleFormatYAML:
+		return writeAnsibleYAML(w, hosts, children)
+	default:
+		return fmt.Errorf("unknown ansible inventory format %q", format)
+	}
+}
+
+func writeAnsibleINI(w io.Writer, hosts []ansibleExportHost, children map[string][]string) error {
+	fmt.Fprintln(w, "# Ansible inventory generated by assh")
+
+	members := map[string][]string{}
+	for _, host := range hosts {
+		// the variables are set on the ungrouped host line
+		line := []string{host.name}
+		for _, item := range host.vars {
+			line = append(line, fmt.Sprintf("%v=%s", item.Key, ansibleINIQuote(fmt.Sprintf("%v", item.Value))))
+		}
+		fmt.Fprintln(w, strings.Join(line, " "))
+		for _, group := range host.groups {
+			members[group] = append(members[group], host.name)
+		}
+	}
+
+	for _, group := range sortedKeys(children) {
+		fmt.Fprintf(w, "\n[%s]\n", group)
+		for _, name := range members[group] {
+			fmt.Fprintln(w, name)
+		}
+		if len(children[group]) > 0 {
+			fmt.Fprintf(w, "\n[%s:children]\n", group)
+			for _, child := range children[group] {
+				fmt.Fprintln(w, child)
+			}
+		}
+	}
+	return nil
+}
+
+// ansibleINIQuote quotes the values containing spaces or quotes, Ansible
+// splits the host lines like a shell
+func ansibleINIQuote(value string) string {
+	if !strings.ContainsAny(value, " \t'\"") {
+		return value
+	}
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+func writeAnsibleYAML(w io.Writer, hosts []ansibleExportHost, children map[string][]string) error {
+	allHosts := yaml.MapSlice{}
+	members := map[string]yaml.MapSlice{}
+	for _, host := range hosts {
+		allHosts = append(allHosts, yaml.MapItem{Key: host.name, Value: host.vars})
+		for _, group := range host.groups {
+			members[group] = append(members[group], yaml.MapItem{Key: host.name})
+		}
+	}
+
+	groups := yaml.MapSlice{}
+	for _, group := range sortedKeys(children) {
+		definition := yaml.MapSlice{}
+		if len(members[group]) > 0 {
+			definition = append(definition, yaml.MapItem{Key: "hosts", Value: members[group]})
+		}
+		if len(children[group]) > 0 {
+			groupChildren := yaml.MapSlice{}
+			for _, child := range children[group] {
+				groupChildren = append(groupChildren, yaml.MapItem{Key: child})
+			}
+			definition = append(definition, yaml.MapItem{Key: "children", Value: groupChildren})
+		}
+		groups = append(groups, yaml.MapItem{Key: group, Value: definition})
+	}
+
+	all := yaml.MapSlice{{Key: "hosts", Value: allHosts}}
+	if len(groups) > 0 {
+		all = append(all, yaml.MapItem{Key: "children", Value: groups})
+	}
+	out, err := yaml.Marshal(yaml.MapSlice{{Key: "all", Value: all}})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "# Ansible inventory generated by assh")
+	_, err = w.Write(out)
+	return err
+}
+
+func sortedKeys(entries map[string][]string) []string {
+	keys := []string{}
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
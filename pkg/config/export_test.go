@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testExportConfig = `hosts:
+  bastion:
+    HostName: 1.2.3.4
+  web-1:
+    HostName: 10.0.0.1
+    Inherits: web
+    Gateways: bastion
+  db:
+    HostName: 10.0.0.2
+    User: postgres
+    Port: 2222
+    IdentityFile: ~/.ssh/db key
+    Gateways: [direct, bastion]
+  "*.corp":
+    User: corp
+templates:
+  web:
+    User: deploy
+    Inherits: prod
+  prod:
+    IdentityFile: ~/.ssh/prod
+defaults:
+  Port: 22
+`
+
+func TestConfig_WriteAnsibleInventory(t *testing.T) {
+	Convey("Testing Config.WriteAnsibleInventory()", t, FailureContinues, func() {
+		config := New()
+		So(config.LoadConfig(strings.NewReader(testExportConfig)), ShouldBeNil)
+
+		Convey("INI format", func() {
+			var buffer bytes.Buffer
+			So(config.WriteAnsibleInventory(&buffer, AnsibleFormatINI), ShouldBeNil)
+			So(buffer.String(), ShouldEqual, `# Ansible inventory generated by assh
+bastion ansible_host=1.2.3.4 ansible_port=22
+db ansible_host=10.0.0.2 ansible_user=postgres ansible_port=2222 ansible_ssh_private_key_file='~/.ssh/db key'
+web-1 ansible_host=10.0.0.1 ansible_user=deploy ansible_port=22 ansible_ssh_private_key_file=~/.ssh/prod ansible_ssh_common_args='-o ProxyCommand="ssh -W %h:%p -q bastion"'
+
+[prod]
+
+[prod:children]
+web
+
+[web]
+web-1
+`)
+
+			// the ansible inventory provider reads the exported inventory
+			inventory, err := (&ansibleInventoryProvider{format: "ini"}).Parse(buffer.Bytes())
+			So(err, ShouldBeNil)
+			So(inventory.Hosts["web-1"].HostName, ShouldEqual, "10.0.0.1")
+			So(inventory.Hosts["web-1"].Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+			So(inventory.Hosts["web-1"].Inherits, ShouldResemble, composeyaml.Stringorslice{"web"})
+			So(inventory.Hosts["db"].IdentityFile, ShouldResemble, composeyaml.Stringorslice{"~/.ssh/db key"})
+			So(inventory.Templates["web"].Inherits, ShouldResemble, composeyaml.Stringorslice{"prod"})
+		})
+
+		Convey("YAML format", func() {
+			var buffer bytes.Buffer
+			So(config.WriteAnsibleInventory(&buffer, AnsibleFormatYAML), ShouldBeNil)
+			So(buffer.String(), ShouldContainSubstring, `    web-1:
+      ansible_host: 10.0.0.1
+      ansible_user: deploy
+      ansible_port: "22"
+      ansible_ssh_private_key_file: ~/.ssh/prod
+      ansible_ssh_common_args: -o ProxyCommand="ssh -W %h:%p -q bastion"
+  children:
+    prod:
+      children:
+        web: null
+    web:
+      hosts:
+        web-1: null
+`)
+
+			inventory, err := (&ansibleInventoryProvider{format: "yaml"}).Parse(buffer.Bytes())
+			So(err, ShouldBeNil)
+			So(len(inventory.Hosts), ShouldEqual, 3)
+			So(inventory.Hosts["db"].Port, ShouldEqual, "2222")
+			So(inventory.Hosts["db"].Gateways, ShouldBeEmpty)
+			So(inventory.Hosts["web-1"].Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+			So(inventory.Hosts["web-1"].Inherits, ShouldResemble, composeyaml.Stringorslice{"web"})
+		})
+
+		Convey("Gateway paths", func() {
+			So(gatewayToSSHArgs(nil), ShouldEqual, "")
+			So(gatewayToSSHArgs([]string{"direct", "bastion"}), ShouldEqual, "")
+			So(gatewayToSSHArgs([]string{"bastion", "backup"}), ShouldEqual, `-o ProxyCommand="ssh -W %h:%p -q bastion"`)
+			So(gatewayToSSHArgs([]string{"bastion/direct"}), ShouldEqual, `-o ProxyCommand="ssh -W %h:%p -q bastion"`)
+			So(gatewayToSSHArgs([]string{"direct/bastion"}), ShouldEqual, `-o ProxyCommand="ssh -W %h:%p -q bastion"`)
+			So(gatewayToSSHArgs([]string{"direct/direct"}), ShouldEqual, "")
+			So(gatewayToSSHArgs([]string{"inner/outer/edge"}), ShouldEqual, "-J edge,outer,inner")
+
+			// the ansible inventory provider reads the chained gateway
+			host := &Host{}
+			applyAnsibleSSHArgs(host, gatewayToSSHArgs([]string{"inner/outer/edge"}))
+			So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"inner/outer/edge"})
+		})
+
+		Convey("Unknown format", func() {
+			So(config.WriteAnsibleInventory(&bytes.Buffer{}, "toml"), ShouldNotBeNil)
+		})
+	})
+}
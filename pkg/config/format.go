@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of the configuration files
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// formatMarkerRegex matches the `# format: toml` comment starting a file
+var formatMarkerRegex = regexp.MustCompile(`^#\s*format:\s*(yaml|json|toml)\s*$`)
+
+// DetectFormat returns the format of a configuration file: the extension
+// decides, then a leading marker (a `{` for JSON, a `# format: <name>`
+// comment), YAML is the default
+func DetectFormat(filename string, buf []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".toml", ".tml":
+		return FormatTOML
+	}
+
+	trimmed := bytes.TrimLeft(buf, " \t\r\n\ufeff")
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return FormatJSON
+	}
+	firstLine := strings.TrimSpace(strings.SplitN(string(trimmed), "\n", 2)[0])
+	if match := formatMarkerRegex.FindStringSubmatch(strings.ToLower(firstLine)); match != nil {
+		return match[1]
+	}
+	return FormatYAML
+}
+
+// configToYAML converts a JSON or TOML configuration into an equivalent YAML
+// document keeping the order of the keys, the keys are then matched
+// case-insensitively like in the YAML files
+func configToYAML(buf []byte, format string) ([]byte, error) {
+	var doc interface{}
+	var err error
+	switch format {
+	case FormatYAML:
+		return buf, nil
+	case FormatJSON:
+		doc, err = orderedJSON(json.NewDecoder(bytes.NewReader(buf)))
+	case FormatTOML:
+		doc, err = orderedTOML(buf)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", format, err)
+	}
+	return yaml.Marshal(doc)
+}
+
+// orderedJSON decodes the next JSON value, the objects become yaml.MapSlice
+func orderedJSON(decoder *json.Decoder) (interface{}, error) {
+	decoder.UseNumber()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := yaml.MapSlice{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := orderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+		_, err = decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := orderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = decoder.Token()
+		return array, err
+	}
+
+	if number, ok := token.(json.Number); ok {
+		if value, err := number.Int64(); err == nil {
+			return value, nil
+		}
+		return number.Float64()
+	}
+	return token, nil
+}
+
+// orderedTOML decodes a TOML document, the tables become yaml.MapSlice
+// ordered like in the document
+func orderedTOML(buf []byte) (interface{}, error) {
+	var doc map[string]interface{}
+	meta, err := toml.Decode(string(buf), &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// position of the first occurrence of each key path
+	order := map[string]int{}
+	for idx, key := range meta.Keys() {
+		path := strings.Join(key, "\x00")
+		if _, found := order[path]; !found {
+			order[path] = idx
+		}
+	}
+
+	var convert func(value interface{}, path []string) interface{}
+	convert = func(value interface{}, path []string) interface{} {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			keys := []string{}
+			for key := range typed {
+				keys = append(keys, key)
+			}
+			sort.Sort(tomlKeys{keys: keys, path: path, order: order})
+
+			table := yaml.MapSlice{}
+			for _, key := range keys {
+				table = append(table, yaml.MapItem{Key: key, Value: convert(typed[key], childPath(path, key))})
+			}
+			return table
+		case []map[string]interface{}:
+			array := []interface{}{}
+			for _, entry := range typed {
+				array = append(array, convert(entry, path))
+			}
+			return array
+		case []interface{}:
+			array := []interface{}{}
+			for _, entry := range typed {
+				array = append(array, convert(entry, path))
+			}
+			return array
+		case time.Time:
+			return typed.Format(time.RFC3339)
+		}
+		return value
+	}
+	return convert(doc, nil), nil
+}
+
+func childPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
+}
+
+// tomlKeys sorts the keys of a table by their position in the document
+type tomlKeys struct {
+	keys  []string
+	path  []string
+	order map[string]int
+}
+
+func (k tomlKeys) position(key string) int {
+	if idx, found := k.order[strings.Join(childPath(k.path, key), "\x00")]; found {
+		return idx
+	}
+	return len(k.order)
+}
+
+func (k tomlKeys) Len() int      { return len(k.keys) }
+func (k tomlKeys) Swap(i, j int) { k.keys[i], k.keys[j] = k.keys[j], k.keys[i] }
+func (k tomlKeys) Less(i, j int) bool {
+	if k.position(k.keys[i]) != k.position(k.keys[j]) {
+		return k.position(k.keys[i]) < k.position(k.keys[j])
+	}
+	return k.keys[i] < k.keys[j]
+}
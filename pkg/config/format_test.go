@@ -0,0 +1,103 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDetectFormat(t *testing.T) {
+	Convey("Testing DetectFormat()", t, func() {
+		So(DetectFormat("assh.yml", []byte("{}")), ShouldEqual, FormatYAML)
+		So(DetectFormat("hosts.JSON", []byte("hosts: {}")), ShouldEqual, FormatJSON)
+		So(DetectFormat("hosts.toml", []byte("")), ShouldEqual, FormatTOML)
+		So(DetectFormat("hosts", []byte("\n  {\"hosts\": {}}")), ShouldEqual, FormatJSON)
+		So(DetectFormat("hosts", []byte("# Format: TOML\n[hosts.foo]\n")), ShouldEqual, FormatTOML)
+		So(DetectFormat("", []byte("#format:toml\n")), ShouldEqual, FormatTOML)
+		So(DetectFormat("hosts", []byte("# hosts of the team\nhosts: {}\n")), ShouldEqual, FormatYAML)
+	})
+}
+
+func TestConfig_LoadConfig_formats(t *testing.T) {
+	Convey("Testing Config.LoadConfig() with JSON and TOML", t, FailureContinues, func() {
+		for _, source := range []string{
+			`{
+	"Hosts": {
+		"web-1": {"hostname": "1.2.3.4", "Port": 2222, "Gateways": ["bastion", "direct"]},
+		"web-*": {"User": "deploy", "ConnectTimeout": 10, "Compression": "yes"},
+		"bastion": null
+	},
+	"defaults": {"User": "admin"}
+}`,
+			`# format: toml
+[hosts.web-1]
+hostname = "1.2.3.4"
+Port = 2222
+Gateways = ["bastion", "direct"]
+
+[hosts."web-*"]
+User = "deploy"
+ConnectTimeout = 10
+Compression = "yes"
+
+[hosts.bastion]
+
+[Defaults]
+User = "admin"
+`,
+		} {
+			config := New()
+			So(config.LoadConfig(strings.NewReader(source)), ShouldBeNil)
+			So(config.sortedNames(), ShouldResemble, []string{"bastion", "web-*", "web-1"})
+			So(config.hostsOrder, ShouldResemble, map[string]int{"web-1": 0, "web-*": 1, "bastion": 2})
+
+			host, err := config.GetHost("web-1")
+			So(err, ShouldBeNil)
+			So(host.HostName, ShouldEqual, "1.2.3.4")
+			So(host.Port, ShouldEqual, "2222")
+			So(host.User, ShouldEqual, "admin")
+			So([]string(host.Gateways), ShouldResemble, []string{"bastion", "direct"})
+
+			host, err = config.GetHost("web-2")
+			So(err, ShouldBeNil)
+			So(host.User, ShouldEqual, "deploy")
+			So(host.ConnectTimeout, ShouldEqual, 10)
+			So(host.Compression, ShouldEqual, "yes")
+		}
+
+		So(New().LoadConfig(strings.NewReader(`{"hosts": {`)), ShouldNotBeNil)
+		So(New().LoadConfig(strings.NewReader("# format: toml\n[hosts\n")), ShouldNotBeNil)
+	})
+}
+
+func TestConfig_LoadFile_formats(t *testing.T) {
+	Convey("Testing Config.LoadFile() with includes across formats", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte("includes:\n- "+filepath.Join(dir, "assh.d", "*")+"\nhosts:\n  yaml-host:\n    User: yaml\n"), 0644), ShouldBeNil)
+		So(os.Mkdir(filepath.Join(dir, "assh.d"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "generated.json"), []byte(`{"hosts": {"json-host": {"user": "json"}}}`), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "team.toml"), []byte("includes = [\""+filepath.Join(dir, "nested.json")+"\"]\n\n[hosts.toml-host]\nUser = \"toml\"\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "nested.json"), []byte(`{"templates": {"nested": {"User": "nested"}}}`), 0644), ShouldBeNil)
+
+		config := New()
+		So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"json-host", "toml-host", "yaml-host"})
+		So(config.Templates["nested"], ShouldNotBeNil)
+		So(len(config.IncludedFiles()), ShouldEqual, 4)
+
+		origin, found := config.OriginOf("hosts", "toml-host")
+		So(found, ShouldBeTrue)
+		So(origin.String(), ShouldEqual, filepath.Join(dir, "assh.d", "team.toml"))
+		origin, _ = config.OriginOf("hosts", "yaml-host")
+		So(origin.String(), ShouldEqual, filepath.Join(dir, "assh.yml")+":4")
+
+		So(config.Validate(), ShouldBeEmpty)
+	})
+}
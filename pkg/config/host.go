@@ -1,10 +1,15 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"os/user"
+	"strconv"
 	"strings"
 
 	composeyaml "github.com/docker/libcompose/yaml"
@@ -112,11 +117,13 @@ type Host struct {
 	// exposed assh fields
 	Inherits           composeyaml.Stringorslice `yaml:"inherits,omitempty,flow" json:"Inherits,omitempty"`
 	Gateways           composeyaml.Stringorslice `yaml:"gateways,omitempty,flow" json:"Gateways,omitempty"`
+	Locations          []Location                `yaml:"locations,omitempty,flow" json:"Locations,omitempty"`
 	ResolveNameservers composeyaml.Stringorslice `yaml:"resolvenameservers,omitempty,flow" json:"ResolveNameservers,omitempty"`
 	ResolveCommand     string                    `yaml:"resolvecommand,omitempty,flow" json:"ResolveCommand,omitempty"`
 	ControlMasterMkdir string                    `yaml:"controlmastermkdir,omitempty,flow" json:"ControlMasterMkdir,omitempty"`
 	Aliases            composeyaml.Stringorslice `yaml:"aliases,omitempty,flow" json:"Aliases,omitempty"`
 	Hooks              *HostHooks                `yaml:"hooks,omitempty,flow" json:"Hooks,omitempty"`
+	Vars               map[string]string         `yaml:"vars,omitempty,flow" json:"Vars,omitempty"`
 
 	// private assh fields
 	knownHosts []string
@@ -472,6 +479,7 @@ func (h *Host) Options() OptionsList {
 	// exposed assh fields
 	//Inherits
 	//Gateways
+	//Locations
 	//ResolveNameservers
 	//ResolveCommand
 	//ControlMasterMkdir
@@ -980,6 +988,10 @@ func (h *Host) ApplyDefaults(defaults *Host) {
 	}
 	// h.Gateways = utils.ExpandField(h.Gateways)
 
+	if len(h.Locations) == 0 {
+		h.Locations = defaults.Locations
+	}
+
 	if len(h.Aliases) == 0 {
 		h.Aliases = defaults.Aliases
 	}
@@ -996,6 +1008,17 @@ func (h *Host) ApplyDefaults(defaults *Host) {
 	}
 	// h.Inherits = utils.ExpandField(h.Inherits)
 
+	if len(defaults.Vars) > 0 {
+		vars := make(map[string]string, len(defaults.Vars)+len(h.Vars))
+		for key, value := range defaults.Vars {
+			vars[key] = value
+		}
+		for key, value := range h.Vars {
+			vars[key] = value
+		}
+		h.Vars = vars
+	}
+
 	// private assh fields
 	// h.inherited = make(map[string]bool, 0)
 	if h.inputName == "" {
@@ -1302,7 +1325,11 @@ func (h *Host) WriteSSHConfigTo(w io.Writer) error {
 
 		// ssh-config fields with a different behavior
 		if h.isDefault {
-			fmt.Fprintf(w, "  ProxyCommand %s connect --port=%%p %%h\n", asshBinaryPath)
+			if asshProfile != "" {
+				fmt.Fprintf(w, "  ProxyCommand %s --profile=%s connect --port=%%p %%h\n", asshBinaryPath, asshProfile)
+			} else {
+				fmt.Fprintf(w, "  ProxyCommand %s connect --port=%%p %%h\n", asshBinaryPath)
+			}
 		} else {
 			if h.ProxyCommand != "" {
 				fmt.Fprintf(w, "  # ProxyCommand %s\n", h.ProxyCommand)
@@ -1322,6 +1349,13 @@ func (h *Host) WriteSSHConfigTo(w io.Writer) error {
 		if len(h.Gateways) > 0 {
 			fmt.Fprintf(w, "  # Gateways: [%s]\n", strings.Join(h.Gateways, ", "))
 		}
+		if len(h.Locations) > 0 {
+			locations := []string{}
+			for idx := range h.Locations {
+				locations = append(locations, h.Locations[idx].String())
+			}
+			fmt.Fprintf(w, "  # Locations: [%s]\n", strings.Join(locations, ", "))
+		}
 		if len(h.Aliases) > 0 {
 			if aliasIdx == 0 {
 				fmt.Fprintf(w, "  # Aliases: [%s]\n", strings.Join(h.Aliases, ", "))
@@ -1352,27 +1386,104 @@ func (h *Host) WriteSSHConfigTo(w io.Writer) error {
 	return nil
 }
 
+// ExpandString expands the OpenSSH tokens of input, following the semantics
+// of the TOKENS section of ssh_config(5):
+//
+//	%%    a literal '%'
+//	%C    hash of %l%h%p%r
+//	%d    local user's home directory
+//	%h    remote host name
+//	%i    local user ID
+//	%L    local host name, without the domain
+//	%l    local host name, including the domain
+//	%n    original remote host name, as given on the command line
+//	%p    remote port
+//	%r    remote user name
+//	%u    local user name
+//	%name name of the host in the assh configuration
+//
+// Unknown tokens are kept as is.
 func (h *Host) ExpandString(input string) string {
-	output := input
-
-	// name of the host in config
-	output = strings.Replace(output, "%name", h.Name(), -1)
+	if !strings.Contains(input, "%") {
+		return input
+	}
+
+	var output bytes.Buffer
+	for idx := 0; idx < len(input); idx++ {
+		if input[idx] != '%' || idx+1 == len(input) {
+			output.WriteByte(input[idx])
+			continue
+		}
+
+		if strings.HasPrefix(input[idx+1:], "name") {
+			output.WriteString(h.Name())
+			idx += len("name")
+			continue
+		}
+
+		idx++
+		switch token := input[idx]; token {
+		case '%':
+			output.WriteByte('%')
+		case 'C':
+			output.WriteString(h.connectionHash())
+		case 'd':
+			output.WriteString(utils.GetHomeDir())
+		case 'h':
+			output.WriteString(h.HostName)
+		case 'i':
+			output.WriteString(strconv.Itoa(os.Getuid()))
+		case 'L':
+			output.WriteString(strings.SplitN(localHostname(), ".", 2)[0])
+		case 'l':
+			output.WriteString(localHostname())
+		case 'n':
+			output.WriteString(h.inputName)
+		case 'p':
+			output.WriteString(h.Port)
+		case 'r':
+			output.WriteString(h.remoteUser())
+		case 'u':
+			output.WriteString(localUsername())
+		default:
+			output.WriteByte('%')
+			output.WriteByte(token)
+		}
+	}
+	return output.String()
+}
 
-	// original target host name specified on the command line
-	output = strings.Replace(output, "%n", h.inputName, -1)
+// EscapeTokens protects a string against a later ExpandString
+func EscapeTokens(input string) string {
+	return strings.Replace(input, "%", "%%", -1)
+}
 
-	// target host name
-	output = strings.Replace(output, "%h", h.HostName, -1)
+// connectionHash returns the %C token, a SHA1 hash of %l%h%p%r
+func (h *Host) connectionHash() string {
+	hash := sha1.Sum([]byte(localHostname() + h.HostName + h.Port + h.remoteUser()))
+	return hex.EncodeToString(hash[:])
+}
 
-	// port
-	output = strings.Replace(output, "%p", fmt.Sprintf("%s", h.Port), -1)
+// remoteUser returns the %r token, ssh uses the local user name if no user is configured
+func (h *Host) remoteUser() string {
+	if h.User != "" {
+		return h.User
+	}
+	return localUsername()
+}
 
-	// FIXME: add
-	//   %L -> first component of the local host name
-	//   %l -> local host name
-	//   %r -> remote login username
-	//   %u -> username of the user running assh
-	//   %r -> remote login username
+var localHostname = func() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
 
-	return output
+var localUsername = func() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER")
+	}
+	return currentUser.Username
 }
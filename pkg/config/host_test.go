@@ -1,7 +1,9 @@
 package config
 
 import (
+	"crypto/sha1"
 	"fmt"
+	"os"
 	"os/user"
 	"testing"
 
@@ -75,6 +77,27 @@ func TestHost_ExpandString(t *testing.T) {
 		output = host.ExpandString(input)
 		expected = "echo 1.2.3.4 42 abc 1.2.3.4 42 abc"
 		So(output, ShouldEqual, expected)
+
+		Convey("OpenSSH tokens", func() {
+			previousHostname, previousUsername := localHostname, localUsername
+			defer func() { localHostname, localUsername = previousHostname, previousUsername }()
+			localHostname = func() string { return "laptop.example.com" }
+			localUsername = func() string { return "alice" }
+			host.inputName = "abc.zone"
+
+			So(host.ExpandString("%l %L %u %r %n"), ShouldEqual, "laptop.example.com laptop alice alice abc.zone")
+
+			host.User = "bob"
+			So(host.ExpandString("%r@%h:%p"), ShouldEqual, "bob@1.2.3.4:42")
+			So(host.ExpandString("%d"), ShouldEqual, os.Getenv("HOME"))
+			So(host.ExpandString("%i"), ShouldEqual, fmt.Sprintf("%d", os.Getuid()))
+			// sha1("laptop.example.com" + "1.2.3.4" + "42" + "bob")
+			So(host.ExpandString("~/.ssh/cm/%C"), ShouldEqual, "~/.ssh/cm/"+fmt.Sprintf("%x", sha1.Sum([]byte("laptop.example.com1.2.3.442bob"))))
+
+			So(host.ExpandString("100%% %%h %%%h"), ShouldEqual, "100% %h %1.2.3.4")
+			So(host.ExpandString("%x %"), ShouldEqual, "%x %")
+			So(host.ExpandString(EscapeTokens("%h %%")), ShouldEqual, "%h %%")
+		})
 	})
 }
 
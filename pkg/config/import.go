@@ -0,0 +1,387 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+// sshConfigKeywords maps lowercased OpenSSH keywords to the index of the matching Host field
+var sshConfigKeywords = map[string]int{}
+
+// asshOnlyFields are Host fields without OpenSSH equivalent
+var asshOnlyFields = map[string]bool{
+	"Inherits":           true,
+	"Gateways":           true,
+	"Locations":          true,
+	"ResolveNameservers": true,
+	"ResolveCommand":     true,
+	"ControlMasterMkdir": true,
+	"Aliases":            true,
+	"Hooks":              true,
+	"Vars":               true,
+	"Match":              true,
+}
+
+func init() {
+	hostType := reflect.TypeOf(Host{})
+	for i := 0; i < hostType.NumField(); i++ {
+		field := hostType.Field(i)
+		if field.PkgPath != "" || asshOnlyFields[field.Name] {
+			continue
+		}
+		sshConfigKeywords[strings.ToLower(field.Name)] = i
+	}
+}
+
+// sshConfigImporter converts OpenSSH configuration files into a Config
+type sshConfigImporter struct {
+	config   *Config
+	current  []*Host
+	files    map[string]bool
+	warnings []string
+}
+
+func newSSHConfigImporter() *sshConfigImporter {
+	config := New()
+	// keep the generated assh.yml minimal, this is the default value anyway
+	config.ASSHKnownHostFile = ""
+	return &sshConfigImporter{
+		config: config,
+		files:  make(map[string]bool),
+	}
+}
+
+// ImportSSHConfig parses an OpenSSH configuration file (and its includes) and
+// returns the matching Config along with the list of directives that could not be mapped
+func ImportSSHConfig(filename string) (*Config, []string, error) {
+	importer := newSSHConfigImporter()
+	if err := importer.importFile(filename); err != nil {
+		return nil, nil, err
+	}
+	return importer.config, importer.warnings, nil
+}
+
+// ImportSSHConfigFrom parses an OpenSSH configuration stream, relative includes are resolved from ~/.ssh
+func ImportSSHConfigFrom(source io.Reader, name string) (*Config, []string, error) {
+	importer := newSSHConfigImporter()
+	if err := importer.importStream(source, name); err != nil {
+		return nil, nil, err
+	}
+	return importer.config, importer.warnings, nil
+}
+
+func (i *sshConfigImporter) warnf(filename string, line int, format string, args ...interface{}) {
+	i.warnings = append(i.warnings, fmt.Sprintf("%s:%d: %s", filename, line, fmt.Sprintf(format, args...)))
+}
+
+func (i *sshConfigImporter) importFile(filename string) error {
+	path, err := utils.ExpandUser(filename)
+	if err != nil {
+		return err
+	}
+
+	// Anti-loop protection
+	if i.files[path] {
+		return nil
+	}
+	i.files[path] = true
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return i.importStream(file, path)
+}
+
+func (i *sshConfigImporter) importStream(source io.Reader, filename string) error {
+	scanner := bufio.NewScanner(source)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		keyword, value, args, err := splitSSHConfigLine(line)
+		if err != nil {
+			i.warnf(filename, lineno, "%v", err)
+			continue
+		}
+		if err := i.handleDirective(filename, lineno, keyword, value, args); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (i *sshConfigImporter) handleDirective(filename string, lineno int, keyword, value string, args []string) error {
+	switch strings.ToLower(keyword) {
+	case "host":
+		i.current = []*Host{}
+		patterns := []string{}
+		for _, pattern := range args {
+			if strings.HasPrefix(pattern, "!") {
+				i.warnf(filename, lineno, "negated pattern %q is not supported, skipped", pattern)
+				continue
+			}
+			if pattern == "*" {
+				i.current = append(i.current, &i.config.Defaults)
+				continue
+			}
+			patterns = append(patterns, pattern)
+		}
+		if len(patterns) > 0 {
+			host, ok := i.config.Hosts[patterns[0]]
+			if !ok {
+				host = NewHost(patterns[0])
+				i.config.Hosts[patterns[0]] = host
+			}
+			for _, alias := range patterns[1:] {
+				if !stringInSlice(alias, host.Aliases) {
+					host.Aliases = append(host.Aliases, alias)
+				}
+			}
+			i.current = append(i.current, host)
+		}
+		return nil
+	case "match":
+		if len(args) == 1 && strings.ToLower(args[0]) == "all" {
+			i.current = []*Host{&i.config.Defaults}
+			return nil
+		}
+		i.warnf(filename, lineno, "Match block %q cannot be imported, skipped", value)
+		i.current = []*Host{}
+		return nil
+	case "include":
+		for _, pattern := range args {
+			if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "~") {
+				pattern = filepath.Join("~/.ssh", pattern)
+			}
+			expanded, err := utils.ExpandUser(pattern)
+			if err != nil {
+				return err
+			}
+			matches, err := filepath.Glob(expanded)
+			if err != nil {
+				return err
+			}
+			for _, match := range matches {
+				if err := i.importFile(match); err != nil {
+					i.warnf(filename, lineno, "cannot include %q: %v", match, err)
+				}
+			}
+		}
+		return nil
+	}
+
+	// directives before the first Host block are global
+	if i.current == nil {
+		i.current = []*Host{&i.config.Defaults}
+	}
+
+	for _, host := range i.current {
+		if err := i.setOption(host, filename, lineno, keyword, value, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *sshConfigImporter) setOption(host *Host, filename string, lineno int, keyword, value string, args []string) error {
+	switch strings.ToLower(keyword) {
+	case "proxyjump":
+		if len(host.Gateways) > 0 || strings.ToLower(value) == "none" {
+			return nil
+		}
+		gateway, err := proxyJumpToGateway(value)
+		if err != nil {
+			i.warnf(filename, lineno, "%v", err)
+			return nil
+		}
+		host.Gateways = composeyaml.Stringorslice{gateway}
+		return nil
+	case "proxycommand":
+		if len(host.Gateways) > 0 || host.ProxyCommand != "" || strings.ToLower(value) == "none" {
+			return nil
+		}
+		if strings.Contains(value, "connect --port=%p %h") {
+			i.warnf(filename, lineno, "skipping ProxyCommand generated by assh: %q", value)
+			return nil
+		}
+		gateway, err := proxyCommandToGateway(args)
+		if err != nil {
+			i.warnf(filename, lineno, "%v, ProxyCommand kept", err)
+		} else if gateway != "" {
+			host.Gateways = composeyaml.Stringorslice{gateway}
+			return nil
+		}
+		host.ProxyCommand = value
+		return nil
+	}
+
+	idx, ok := sshConfigKeywords[strings.ToLower(keyword)]
+	if !ok {
+		i.warnf(filename, lineno, "unsupported keyword %q, skipped", keyword)
+		return nil
+	}
+
+	field := reflect.ValueOf(host).Elem().Field(idx)
+	switch field.Kind() {
+	case reflect.String:
+		// OpenSSH uses the first obtained value
+		if field.String() == "" {
+			field.SetString(value)
+		}
+	case reflect.Int:
+		if field.Int() == 0 {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				i.warnf(filename, lineno, "invalid numeric value for %q: %q", keyword, value)
+				return nil
+			}
+			field.SetInt(int64(number))
+		}
+	case reflect.Slice:
+		field.Set(reflect.Append(field, reflect.ValueOf(value)))
+	default:
+		return fmt.Errorf("unhandled field type for %q", keyword)
+	}
+	return nil
+}
+
+// proxyJumpToGateway converts an OpenSSH ProxyJump chain (first hop first)
+// into an assh gateway path (last hop first)
+func proxyJumpToGateway(value string) (string, error) {
+	hops := strings.Split(value, ",")
+	gateway := []string{}
+	for idx := len(hops) - 1; idx >= 0; idx-- {
+		hop := strings.TrimSpace(hops[idx])
+		if strings.Contains(hop, "@") || strings.Contains(hop, ":") {
+			return "", fmt.Errorf("ProxyJump hop %q contains a user or a port, define it as a host instead", hop)
+		}
+		gateway = append(gateway, hop)
+	}
+	return strings.Join(gateway, "/"), nil
+}
+
+// proxyCommandToGateway detects the common `ssh -W %h:%p gateway` and
+// `ssh gateway nc %h %p` ProxyCommand forms and returns the gateway name,
+// like with ProxyJump a gateway with a user or a port is rejected
+func proxyCommandToGateway(args []string) (string, error) {
+	gateway := detectProxyCommandGateway(args)
+	if strings.Contains(gateway, "@") || strings.Contains(gateway, ":") {
+		return "", fmt.Errorf("ProxyCommand gateway %q contains a user or a port, define it as a host instead", gateway)
+	}
+	return gateway, nil
+}
+
+func detectProxyCommandGateway(args []string) string {
+	if len(args) < 2 || args[0] != "ssh" {
+		return ""
+	}
+
+	gateway := ""
+	forward := false
+	for idx := 1; idx < len(args); idx++ {
+		switch arg := args[idx]; {
+		case arg == "-W" && idx+1 < len(args) && args[idx+1] == "%h:%p":
+			forward = true
+			idx++
+		case arg == "-q":
+		case strings.HasPrefix(arg, "-"):
+			return ""
+		case gateway == "":
+			gateway = arg
+		case strings.Join(args[idx:], " ") == "nc %h %p":
+			return gateway
+		default:
+			return ""
+		}
+	}
+	if forward {
+		return gateway
+	}
+	return ""
+}
+
+// splitSSHConfigLine splits an OpenSSH configuration line into a keyword,
+// its raw value and its arguments, following the `keyword [=] arguments` syntax
+func splitSSHConfigLine(line string) (string, string, []string, error) {
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return "", "", nil, fmt.Errorf("missing argument for %q", line)
+	}
+	keyword := line[:end]
+	rest := strings.TrimSpace(line[end:])
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimSpace(rest[1:])
+	}
+	if rest == "" {
+		return "", "", nil, fmt.Errorf("missing argument for %q", keyword)
+	}
+
+	args, err := splitQuoted(rest, `"`)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%v for %q", err, keyword)
+	}
+
+	value := rest
+	if len(args) == 1 {
+		value = args[0]
+	}
+	return keyword, value, args, nil
+}
+
+// splitQuoted splits a string on blanks, words surrounded by one of the quotes characters are grouped
+func splitQuoted(input string, quotes string) ([]string, error) {
+	args := []string{}
+	var current []rune
+	var quote rune
+	inArg := false
+	for _, r := range input {
+		switch {
+		case quote == 0 && strings.ContainsRune(quotes, r):
+			quote = r
+			inArg = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case (r == ' ' || r == '\t') && quote == 0:
+			if inArg {
+				args = append(args, string(current))
+				current = nil
+				inArg = false
+			}
+		default:
+			current = append(current, r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unbalanced quotes")
+	}
+	if inArg {
+		args = append(args, string(current))
+	}
+	return args, nil
+}
+
+func stringInSlice(needle string, haystack []string) bool {
+	for _, entry := range haystack {
+		if entry == needle {
+			return true
+		}
+	}
+	return false
+}
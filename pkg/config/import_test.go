@@ -0,0 +1,121 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImportSSHConfigFrom(t *testing.T) {
+	Convey("Testing ImportSSHConfigFrom()", t, FailureContinues, func() {
+		input := `
+# global options
+ServerAliveInterval 30
+
+Host bastion bastion.example.com
+  HostName 1.2.3.4
+  User admin
+  Port=2222
+  IdentityFile ~/.ssh/id_bastion
+  IdentityFile "~/.ssh/id with spaces"
+
+Host web-*
+  ProxyCommand ssh -W %h:%p bastion
+  LocalForward 8080 localhost:80
+
+Host db
+  ProxyJump bastion,web-1
+  AddKeysToAgent yes
+
+Host legacy
+  ProxyCommand ssh legacy-gw nc %h %p
+
+Host custom
+  ProxyCommand sh -c "nc -x proxy:1080 %h %p"
+
+Match exec "test -f /tmp/vpn"
+  User vpn
+
+Host *
+  User bob
+  ProxyCommand assh connect --port=%p %h
+`
+		config, warnings, err := ImportSSHConfigFrom(strings.NewReader(input), "config")
+		So(err, ShouldBeNil)
+		So(warnings, ShouldResemble, []string{
+			`config:18: unsupported keyword "AddKeysToAgent", skipped`,
+			`config:26: Match block "exec \"test -f /tmp/vpn\"" cannot be imported, skipped`,
+			`config:31: skipping ProxyCommand generated by assh: "assh connect --port=%p %h"`,
+		})
+
+		So(len(config.Hosts), ShouldEqual, 5)
+		So(config.Hosts["bastion"].HostName, ShouldEqual, "1.2.3.4")
+		So(config.Hosts["bastion"].Port, ShouldEqual, "2222")
+		So(config.Hosts["bastion"].Aliases, ShouldResemble, composeyaml.Stringorslice{"bastion.example.com"})
+		So(config.Hosts["bastion"].IdentityFile, ShouldResemble, composeyaml.Stringorslice{"~/.ssh/id_bastion", "~/.ssh/id with spaces"})
+		So(config.Hosts["web-*"].Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+		So(config.Hosts["web-*"].LocalForward, ShouldResemble, composeyaml.Stringorslice{"8080 localhost:80"})
+		So(config.Hosts["db"].Gateways, ShouldResemble, composeyaml.Stringorslice{"web-1/bastion"})
+		So(config.Hosts["legacy"].Gateways, ShouldResemble, composeyaml.Stringorslice{"legacy-gw"})
+		So(config.Hosts["custom"].ProxyCommand, ShouldEqual, `sh -c "nc -x proxy:1080 %h %p"`)
+		So(config.Defaults.ServerAliveInterval, ShouldEqual, 30)
+		So(config.Defaults.User, ShouldEqual, "bob")
+		So(config.Defaults.ProxyCommand, ShouldEqual, "")
+
+		out, err := config.YamlString()
+		So(err, ShouldBeNil)
+		reloaded := New()
+		So(reloaded.LoadConfig(strings.NewReader(string(out))), ShouldBeNil)
+		So(reloaded.Hosts["db"].Gateways, ShouldResemble, composeyaml.Stringorslice{"web-1/bastion"})
+		So(reloaded.Hosts["bastion"].Port, ShouldEqual, "2222")
+		So(reloaded.Defaults.User, ShouldEqual, "bob")
+	})
+}
+
+func TestImportSSHConfigFrom_GatewayUser(t *testing.T) {
+	Convey("Testing ImportSSHConfigFrom() with a user in the gateway", t, FailureContinues, func() {
+		config, warnings, err := ImportSSHConfigFrom(strings.NewReader(`Host jump
+  ProxyJump admin@bastion
+Host command
+  ProxyCommand ssh -W %h:%p admin@bastion
+`), "config")
+		So(err, ShouldBeNil)
+		So(warnings, ShouldResemble, []string{
+			`config:2: ProxyJump hop "admin@bastion" contains a user or a port, define it as a host instead`,
+			`config:4: ProxyCommand gateway "admin@bastion" contains a user or a port, define it as a host instead, ProxyCommand kept`,
+		})
+		So(config.Hosts["jump"].Gateways, ShouldBeEmpty)
+		So(config.Hosts["command"].Gateways, ShouldBeEmpty)
+		So(config.Hosts["command"].ProxyCommand, ShouldEqual, "ssh -W %h:%p admin@bastion")
+
+		_, err = proxyCommandToGateway([]string{"ssh", "admin@bastion", "nc", "%h", "%p"})
+		So(err, ShouldNotBeNil)
+		gateway, err := proxyCommandToGateway([]string{"ssh", "-W", "%h:%p", "bastion"})
+		So(err, ShouldBeNil)
+		So(gateway, ShouldEqual, "bastion")
+	})
+}
+
+func TestSplitSSHConfigLine(t *testing.T) {
+	Convey("Testing splitSSHConfigLine()", t, FailureContinues, func() {
+		keyword, value, args, err := splitSSHConfigLine(`Host a "b c"`)
+		So(err, ShouldBeNil)
+		So(keyword, ShouldEqual, "Host")
+		So(value, ShouldEqual, `a "b c"`)
+		So(args, ShouldResemble, []string{"a", "b c"})
+
+		keyword, value, args, err = splitSSHConfigLine(`Port = 22`)
+		So(err, ShouldBeNil)
+		So(keyword, ShouldEqual, "Port")
+		So(value, ShouldEqual, "22")
+		So(args, ShouldResemble, []string{"22"})
+
+		_, _, _, err = splitSSHConfigLine(`User "bob`)
+		So(err, ShouldNotBeNil)
+
+		_, _, _, err = splitSSHConfigLine(`User`)
+		So(err, ShouldNotBeNil)
+	})
+}
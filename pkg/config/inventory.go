@@ -0,0 +1,365 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/flexyaml"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+const (
+	defaultInventoryCacheDir = "~/.ssh/assh_inventory_cache"
+	defaultInventoryTTL      = 5 * time.Minute
+)
+
+// Include is an entry of the includes section, either a file pattern or a
+// dynamic inventory provider with its parameters
+type Include struct {
+	Pattern  string
+	Provider string
+	Params   map[string]interface{}
+
+	// dir is the directory of the file declaring the include
+	dir string
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (i *Include) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var pattern string
+	if err := unmarshal(&pattern); err == nil {
+		i.Pattern = pattern
+		return nil
+	}
+
+	var params map[string]interface{}
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+	i.Params = make(map[string]interface{})
+	for key, value := range params {
+		i.Params[strings.ToLower(key)] = jsonCompatible(value)
+	}
+	i.Provider = i.Param("provider")
+	delete(i.Params, "provider")
+	if i.Provider == "" {
+		return fmt.Errorf("include entries must be a file pattern or have a provider")
+	}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (i Include) MarshalJSON() ([]byte, error) {
+	if i.Provider == "" {
+		return json.Marshal(i.Pattern)
+	}
+	params := map[string]interface{}{"provider": i.Provider}
+	for key, value := range i.Params {
+		params[key] = value
+	}
+	return json.Marshal(params)
+}
+
+// String returns the pattern or a "provider:params" description of the include
+func (i Include) String() string {
+	if i.Provider == "" {
+		return i.Pattern
+	}
+	keys := []string{}
+	for key := range i.Params {
+		if key != "ttl" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		params = append(params, fmt.Sprintf("%v", i.Params[key]))
+	}
+	return fmt.Sprintf("%s:%s", i.Provider, strings.Join(params, ","))
+}
+
+// Param returns the value of a string parameter of the include
+func (i Include) Param(name string) string {
+	value, found := i.Params[name]
+	if !found || value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Path resolves a path parameter relatively to the file declaring the include
+func (i Include) Path(name string) (string, error) {
+	path, err := utils.ExpandUser(i.Param(name))
+	if err != nil {
+		return "", err
+	}
+	if path != "" && !filepath.IsAbs(path) && i.dir != "" {
+		path = filepath.Join(i.dir, path)
+	}
+	return path, nil
+}
+
+// TTL returns the duration during which the result of the provider is cached
+func (i Include) TTL() (time.Duration, error) {
+	ttl := i.Param("ttl")
+	if ttl == "" {
+		return defaultInventoryTTL, nil
+	}
+	return time.ParseDuration(ttl)
+}
+
+// jsonCompatible converts the map[interface{}]interface{} decoded by yaml into map[string]interface{}
+func jsonCompatible(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		ret := make(map[string]interface{})
+		for key, entry := range typed {
+			ret[fmt.Sprintf("%v", key)] = jsonCompatible(entry)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, 0, len(typed))
+		for _, entry := range typed {
+			ret = append(ret, jsonCompatible(entry))
+		}
+		return ret
+	default:
+		return value
+	}
+}
+
+// Inventory is a set of hosts and templates returned by an InventoryProvider
+type Inventory struct {
+	Hosts     HostsMap `yaml:"hosts" json:"hosts"`
+	Templates HostsMap `yaml:"templates" json:"templates,omitempty"`
+}
+
+// InventoryProvider is a dynamic source of hosts
+type InventoryProvider interface {
+	// Fetch returns the raw inventory, it is cached until the TTL of the include expires
+	Fetch() ([]byte, error)
+	// Parse converts a raw inventory into hosts and templates
+	Parse(raw []byte) (*Inventory, error)
+}
+
+// LocalInventoryProvider is implemented by the providers reading local files,
+// their result is never cached
+type LocalInventoryProvider interface {
+	InventoryProvider
+	Local() bool
+}
+
+// InventoryProviderFactory creates an InventoryProvider for an include entry
+type InventoryProviderFactory func(include Include) (InventoryProvider, error)
+
+var inventoryProviders = map[string]InventoryProviderFactory{}
+
+// RegisterInventoryProvider makes an inventory provider available in the includes section
+func RegisterInventoryProvider(name string, factory InventoryProviderFactory) {
+	inventoryProviders[name] = factory
+}
+
+// providerNames returns the names of the registered inventory providers, sorted
+func providerNames() []string {
+	names := []string{}
+	for name := range inventoryProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterInventoryProvider("exec", newExecInventoryProvider)
+}
+
+// execInventoryProvider runs a command printing the hosts in the assh
+// configuration format (JSON or YAML), i.e: {"hosts": {"foo": {"HostName": "1.2.3.4"}}}
+type execInventoryProvider struct {
+	command string
+	dir     string
+}
+
+func newExecInventoryProvider(include Include) (InventoryProvider, error) {
+	command := include.Param("command")
+	if command == "" {
+		return nil, fmt.Errorf("missing command parameter")
+	}
+	return &execInventoryProvider{command: command, dir: include.dir}, nil
+}
+
+func (p *execInventoryProvider) Fetch() ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", p.command)
+	cmd.Dir = p.dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%q failed: %v: %s", p.command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (p *execInventoryProvider) Parse(raw []byte) (*Inventory, error) {
+	var inventory Inventory
+	if err := flexyaml.Unmarshal(raw, &inventory); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+// inventoryCachePath returns the path of the cache file of an include
+func (c *Config) inventoryCachePath(include Include) (string, error) {
+	dir, err := utils.ExpandUser(c.inventoryCacheDir)
+	if err != nil {
+		return "", err
+	}
+	key, err := json.Marshal(include)
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum(append(key, []byte(include.dir)...))
+	return filepath.Join(dir, hex.EncodeToString(hash[:])+".cache"), nil
+}
+
+// fetchInventory returns the raw inventory of an include from the cache if
+// it is still valid or from the provider otherwise
+func (c *Config) fetchInventory(include Include, provider InventoryProvider) ([]byte, error) {
+	if local, ok := provider.(LocalInventoryProvider); ok && local.Local() {
+		if path, err := include.Path("path"); err == nil && path != "" {
+			c.stamps[path] = stampFile(path)
+		}
+		return provider.Fetch()
+	}
+
+	ttl, err := include.TTL()
+	if err != nil {
+		return nil, err
+	}
+	cachePath, err := c.inventoryCachePath(include)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, statErr := os.Stat(cachePath)
+	if statErr == nil && time.Since(stat.ModTime()) < ttl {
+		Logger.Debugf("Using cached inventory %q for %q", cachePath, include)
+		c.dependOnInventoryCache(cachePath, stat.ModTime().Add(ttl))
+		return ioutil.ReadFile(cachePath)
+	}
+
+	raw, err := provider.Fetch()
+	if err != nil {
+		if statErr != nil {
+			return nil, err
+		}
+		// an outdated inventory is better than no inventory at all
+		Logger.Warnf("Cannot refresh inventory %q, using the cached version: %v", include, err)
+		c.volatile = true
+		return ioutil.ReadFile(cachePath)
+	}
+
+	if ttl > 0 {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+			Logger.Warnf("Cannot cache inventory %q: %v", include, err)
+		} else if err := ioutil.WriteFile(cachePath, raw, 0600); err != nil {
+			Logger.Warnf("Cannot cache inventory %q: %v", include, err)
+		} else {
+			c.dependOnInventoryCache(cachePath, time.Now().Add(ttl))
+			return raw, nil
+		}
+	}
+	c.volatile = true
+	return raw, nil
+}
+
+// dependOnInventoryCache records an inventory cache file used by the
+// configuration, the compiled configuration expires with it
+func (c *Config) dependOnInventoryCache(cachePath string, expiry time.Time) {
+	c.stamps[cachePath] = stampFile(cachePath)
+	if c.cacheExpiry.IsZero() || expiry.Before(c.cacheExpiry) {
+		c.cacheExpiry = expiry
+	}
+}
+
+// LoadInventory loads the hosts and templates of a dynamic inventory provider
+// in the Config object, they override the existing definitions
+func (c *Config) LoadInventory(include Include) error {
+	factory, found := inventoryProviders[include.Provider]
+	if !found {
+		return fmt.Errorf("unknown inventory provider %q", include.Provider)
+	}
+	provider, err := factory(include)
+	if err != nil {
+		return err
+	}
+
+	raw, err := c.fetchInventory(include, provider)
+	if err != nil {
+		return err
+	}
+	inventory, err := provider.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	Logger.Debugf("Loaded inventory %q (%d hosts, %d templates)", include, len(inventory.Hosts), len(inventory.Templates))
+	c.mergeInventory(inventory, Origin{File: include.String()})
+	return nil
+}
+
+func (c *Config) mergeInventory(inventory *Inventory, origin Origin) {
+	sections := []struct {
+		name    string
+		items   HostsMap
+		current HostsMap
+		order   map[string]int
+	}{
+		{"hosts", inventory.Hosts, c.Hosts, c.hostsOrder},
+		{"templates", inventory.Templates, c.Templates, c.templatesOrder},
+	}
+	for _, section := range sections {
+		names := []string{}
+		for name := range section.items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			host := section.items[name]
+			if host == nil {
+				host = &Host{}
+			}
+			key := section.name + "/" + name
+			if before, found := section.current[name]; found && !sameDefinition(before, host) {
+				c.addRedefinition(origin, "%s %q overrides the definition from %s", strings.TrimSuffix(section.name, "s"), name, c.Origins[key])
+			}
+			for path := range c.Origins {
+				if strings.HasPrefix(path, key+"/") {
+					delete(c.Origins, path)
+				}
+			}
+			c.Origins[key] = origin
+			for _, option := range host.Options() {
+				c.Origins[key+"/"+option.Name] = origin
+			}
+			if _, found := section.order[name]; !found {
+				section.order[name] = len(section.order)
+			}
+			section.current[name] = host
+		}
+	}
+	c.applyMissingNames()
+}
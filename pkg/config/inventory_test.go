@@ -0,0 +1,121 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig_LoadInventory(t *testing.T) {
+	Convey("Testing Config.LoadInventory()", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(filepath.Join(dir, "inventory.sh"), []byte(`#!/bin/sh
+echo run >> calls.log
+cat <<EOF
+{
+  "hosts": {
+    "web-1": {"HostName": "10.0.0.1", "Inherits": ["web"]},
+    "aaa": {"HostName": "10.0.0.2"}
+  },
+  "templates": {
+    "web": {"User": "deploy"}
+  }
+}
+EOF
+`), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte(`hosts:
+  aaa:
+    HostName: 1.2.3.4
+  bbb:
+    HostName: 5.6.7.8
+includes:
+- provider: exec
+  command: ./inventory.sh
+  ttl: 1h
+`), 0644), ShouldBeNil)
+
+		load := func() *Config {
+			config := New()
+			config.inventoryCacheDir = filepath.Join(dir, "cache")
+			So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+			return config
+		}
+		calls := func() int {
+			buf, _ := ioutil.ReadFile(filepath.Join(dir, "calls.log"))
+			return strings.Count(string(buf), "run")
+		}
+
+		config := load()
+		So(calls(), ShouldEqual, 1)
+		So(len(config.Includes), ShouldEqual, 1)
+		So(config.Includes[0].Provider, ShouldEqual, "exec")
+		So(config.Includes[0].String(), ShouldEqual, "exec:./inventory.sh")
+
+		So(len(config.Hosts), ShouldEqual, 3)
+		So(config.Hosts["aaa"].HostName, ShouldEqual, "10.0.0.2")
+		So(config.Hosts["bbb"].HostName, ShouldEqual, "5.6.7.8")
+
+		host, err := config.GetHost("web-1")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "10.0.0.1")
+		So(host.User, ShouldEqual, "deploy")
+
+		origin, found := config.OriginOf("hosts", "web-1")
+		So(found, ShouldBeTrue)
+		So(origin.String(), ShouldEqual, "exec:./inventory.sh")
+		So(len(config.Redefinitions()), ShouldEqual, 1)
+		So(config.Redefinitions()[0].Message, ShouldContainSubstring, `host "aaa" overrides the definition from`)
+
+		// the second load uses the cache
+		config = load()
+		So(calls(), ShouldEqual, 1)
+		So(config.Hosts["web-1"].HostName, ShouldEqual, "10.0.0.1")
+
+		Convey("with file includes", func() {
+			So(os.MkdirAll(filepath.Join(dir, "assh.d"), 0755), ShouldBeNil)
+			script, err := ioutil.ReadFile(filepath.Join(dir, "inventory.sh"))
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "inventory.sh"), script, 0755), ShouldBeNil)
+			for _, name := range []string{"a", "b", "c"} {
+				So(ioutil.WriteFile(filepath.Join(dir, "assh.d", name+".yml"), []byte("hosts:\n  "+name+":\n    User: "+name+"\n"), 0644), ShouldBeNil)
+			}
+			So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte(`includes:
+- `+filepath.Join(dir, "assh.d", "*.yml")+`
+- provider: exec
+  command: ./inventory.sh
+`), 0644), ShouldBeNil)
+
+			config := New()
+			config.inventoryCacheDir = filepath.Join(dir, "other-cache")
+			So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+			So(len(config.Hosts), ShouldEqual, 5)
+			So(len(config.Includes), ShouldEqual, 2)
+
+			// the provider runs once, from the directory of the file declaring it
+			So(calls(), ShouldEqual, 2)
+			_, err = os.Stat(filepath.Join(dir, "assh.d", "calls.log"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("JSON output", func() {
+			output, err := json.Marshal(config.Includes)
+			So(err, ShouldBeNil)
+			So(string(output), ShouldEqual, `[{"command":"./inventory.sh","provider":"exec","ttl":"1h"}]`)
+		})
+
+		Convey("Unknown provider", func() {
+			config := New()
+			err := config.LoadInventory(Include{Provider: "unknown"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `unknown inventory provider "unknown"`)
+		})
+	})
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+)
+
+const locationProbeTimeout = time.Second
+
+// Location is a network location selecting the gateways of a host, all the
+// conditions of a location must match, a location without conditions always matches
+type Location struct {
+	Name string `yaml:"name,omitempty,flow" json:"Name,omitempty"`
+	// CIDR matches if a local interface has an address in one of the networks
+	CIDR composeyaml.Stringorslice `yaml:"cidr,omitempty,flow" json:"CIDR,omitempty"`
+	// Route matches if the default route goes through one of the addresses
+	Route composeyaml.Stringorslice `yaml:"route,omitempty,flow" json:"Route,omitempty"`
+	// Probe matches if a TCP connection to the host:port address succeeds
+	Probe string `yaml:"probe,omitempty,flow" json:"Probe,omitempty"`
+	// Env matches if the NAME environment variable is set, or equals value for NAME=value
+	Env string `yaml:"env,omitempty,flow" json:"Env,omitempty"`
+	// Gateways replaces the gateways of the host when the location matches
+	Gateways composeyaml.Stringorslice `yaml:"gateways,omitempty,flow" json:"Gateways,omitempty"`
+}
+
+// String returns the name of the location or a description of its conditions
+func (l *Location) String() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	conditions := []string{}
+	if len(l.CIDR) > 0 {
+		conditions = append(conditions, fmt.Sprintf("cidr=%s", strings.Join(l.CIDR, ",")))
+	}
+	if len(l.Route) > 0 {
+		conditions = append(conditions, fmt.Sprintf("route=%s", strings.Join(l.Route, ",")))
+	}
+	if l.Probe != "" {
+		conditions = append(conditions, fmt.Sprintf("probe=%s", l.Probe))
+	}
+	if l.Env != "" {
+		conditions = append(conditions, fmt.Sprintf("env=%s", l.Env))
+	}
+	if len(conditions) == 0 {
+		return "default"
+	}
+	return strings.Join(conditions, " ")
+}
+
+// LocationDetector evaluates the conditions of the locations, the local
+// addresses, the default routes and each probe are only checked once
+type LocationDetector struct {
+	interfaceAddrs func() ([]net.Addr, error)
+	defaultRoutes  func() ([]net.IP, error)
+	dial           func(address string) error
+	lookupEnv      func(name string) string
+
+	addrs  []net.IP
+	routes []net.IP
+	probes map[string]error
+	loaded bool
+}
+
+// NewLocationDetector returns a LocationDetector inspecting the local system
+func NewLocationDetector() *LocationDetector {
+	return &LocationDetector{
+		interfaceAddrs: net.InterfaceAddrs,
+		defaultRoutes:  defaultRoutes,
+		dial: func(address string) error {
+			conn, err := net.DialTimeout("tcp", address, locationProbeTimeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+		lookupEnv: os.Getenv,
+		probes:    make(map[string]error),
+	}
+}
+
+func (d *LocationDetector) load() {
+	if d.loaded {
+		return
+	}
+	d.loaded = true
+
+	if addrs, err := d.interfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				d.addrs = append(d.addrs, ipnet.IP)
+			}
+		}
+	}
+	if routes, err := d.defaultRoutes(); err == nil {
+		d.routes = routes
+	}
+}
+
+// Match returns true and the reason if every condition of the location matches
+func (d *LocationDetector) Match(location *Location) (bool, string, error) {
+	d.load()
+	reasons := []string{}
+
+	if len(location.CIDR) > 0 {
+		found := ""
+		for _, cidr := range location.CIDR {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return false, "", fmt.Errorf("location %q: %v", location, err)
+			}
+			for _, addr := range d.addrs {
+				if network.Contains(addr) {
+					found = fmt.Sprintf("local address %s is in %s", addr, cidr)
+					break
+				}
+			}
+			if found != "" {
+				break
+			}
+		}
+		if found == "" {
+			return false, "", nil
+		}
+		reasons = append(reasons, found)
+	}
+
+	if len(location.Route) > 0 {
+		found := ""
+		for _, route := range location.Route {
+			ip := net.ParseIP(route)
+			if ip == nil {
+				return false, "", fmt.Errorf("location %q: invalid route address %q", location, route)
+			}
+			for _, gateway := range d.routes {
+				if gateway.Equal(ip) {
+					found = fmt.Sprintf("default route via %s", route)
+					break
+				}
+			}
+			if found != "" {
+				break
+			}
+		}
+		if found == "" {
+			return false, "", nil
+		}
+		reasons = append(reasons, found)
+	}
+
+	if location.Env != "" {
+		parts := strings.SplitN(location.Env, "=", 2)
+		value := d.lookupEnv(parts[0])
+		if (len(parts) == 1 && value == "") || (len(parts) == 2 && value != parts[1]) {
+			return false, "", nil
+		}
+		reasons = append(reasons, fmt.Sprintf("$%s is %q", parts[0], value))
+	}
+
+	// probes are the most expensive conditions, they are checked last
+	if location.Probe != "" {
+		err, found := d.probes[location.Probe]
+		if !found {
+			err = d.dial(location.Probe)
+			d.probes[location.Probe] = err
+		}
+		if err != nil {
+			return false, "", nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s is reachable", location.Probe))
+	}
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, "no conditions")
+	}
+	return true, strings.Join(reasons, ", "), nil
+}
+
+// SelectLocation returns the first location of the host matching the
+// current network with the reason, or nil if none matches
+func (h *Host) SelectLocation(detector *LocationDetector) (*Location, string, error) {
+	for idx := range h.Locations {
+		location := &h.Locations[idx]
+		matched, reason, err := detector.Match(location)
+		if err != nil {
+			return nil, "", err
+		}
+		if matched {
+			return location, reason, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// defaultRoutes returns the gateways of the default routes
+func defaultRoutes() ([]net.IP, error) {
+	if file, err := os.Open("/proc/net/route"); err == nil {
+		defer file.Close()
+		return parseProcNetRoute(file)
+	}
+
+	// BSD and macOS
+	output, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return nil, err
+	}
+	routes := []net.IP{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "gateway:" {
+			if ip := net.ParseIP(fields[1]); ip != nil {
+				routes = append(routes, ip)
+			}
+		}
+	}
+	return routes, nil
+}
+
+// parseProcNetRoute parses the Linux /proc/net/route table, addresses are
+// hexadecimal little-endian values
+func parseProcNetRoute(file io.Reader) ([]net.IP, error) {
+	routes := []net.IP{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		routes = append(routes, ip)
+	}
+	return routes, scanner.Err()
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testLocationDetector(env map[string]string, reachable ...string) (*LocationDetector, *int) {
+	dials := 0
+	return &LocationDetector{
+		interfaceAddrs: func() ([]net.Addr, error) {
+			_, network, _ := net.ParseCIDR("10.1.2.0/24")
+			network.IP = net.ParseIP("10.1.2.3")
+			return []net.Addr{network}, nil
+		},
+		defaultRoutes: func() ([]net.IP, error) {
+			return []net.IP{net.ParseIP("192.168.1.254")}, nil
+		},
+		dial: func(address string) error {
+			dials++
+			for _, entry := range reachable {
+				if entry == address {
+					return nil
+				}
+			}
+			return fmt.Errorf("connection refused")
+		},
+		lookupEnv: func(name string) string { return env[name] },
+		probes:    make(map[string]error),
+	}, &dials
+}
+
+func TestHost_SelectLocation(t *testing.T) {
+	Convey("Testing Host.SelectLocation()", t, FailureContinues, func() {
+		config := New()
+		So(config.LoadConfig(strings.NewReader(`hosts:
+  aaa:
+    Gateways: bastion
+    Locations:
+    - name: office
+      cidr: [172.16.0.0/12, 10.0.0.0/8]
+      gateways: direct
+    - route: 192.168.1.254
+      probe: intranet:22
+      gateways: [vpn, direct]
+  bbb:
+    Locations:
+    - env: ASSH_LOCATION=travel
+      gateways: hotspot
+    - probe: intranet:22
+      gateways: direct
+    - gateways: bastion
+`)), ShouldBeNil)
+
+		aaa, err := config.GetHost("aaa")
+		So(err, ShouldBeNil)
+		bbb, err := config.GetHost("bbb")
+		So(err, ShouldBeNil)
+
+		Convey("CIDR", func() {
+			detector, _ := testLocationDetector(nil)
+			location, reason, err := aaa.SelectLocation(detector)
+			So(err, ShouldBeNil)
+			So(location.String(), ShouldEqual, "office")
+			So(location.Gateways, ShouldResemble, composeyaml.Stringorslice{"direct"})
+			So(reason, ShouldEqual, "local address 10.1.2.3 is in 10.0.0.0/8")
+		})
+
+		Convey("Route and probe", func() {
+			aaa.Locations[0].CIDR = composeyaml.Stringorslice{"172.16.0.0/12"}
+			detector, dials := testLocationDetector(nil, "intranet:22")
+			location, reason, err := aaa.SelectLocation(detector)
+			So(err, ShouldBeNil)
+			So(location.String(), ShouldEqual, "route=192.168.1.254 probe=intranet:22")
+			So(reason, ShouldEqual, "default route via 192.168.1.254, intranet:22 is reachable")
+
+			// probes are evaluated once
+			_, _, err = bbb.SelectLocation(detector)
+			So(err, ShouldBeNil)
+			So(*dials, ShouldEqual, 1)
+		})
+
+		Convey("Env and fallback", func() {
+			detector, _ := testLocationDetector(map[string]string{"ASSH_LOCATION": "travel"})
+			location, reason, err := bbb.SelectLocation(detector)
+			So(err, ShouldBeNil)
+			So(location.Gateways, ShouldResemble, composeyaml.Stringorslice{"hotspot"})
+			So(reason, ShouldEqual, `$ASSH_LOCATION is "travel"`)
+
+			detector, _ = testLocationDetector(nil)
+			location, reason, err = bbb.SelectLocation(detector)
+			So(err, ShouldBeNil)
+			So(location.String(), ShouldEqual, "default")
+			So(location.Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+			So(reason, ShouldEqual, "no conditions")
+		})
+
+		Convey("No match", func() {
+			aaa.Locations[0].CIDR = composeyaml.Stringorslice{"172.16.0.0/12"}
+			detector, _ := testLocationDetector(nil)
+			location, _, err := aaa.SelectLocation(detector)
+			So(err, ShouldBeNil)
+			So(location, ShouldBeNil)
+		})
+
+		Convey("Invalid CIDR", func() {
+			aaa.Locations[0].CIDR = composeyaml.Stringorslice{"10.0.0.0/64"}
+			detector, _ := testLocationDetector(nil)
+			_, _, err := aaa.SelectLocation(detector)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Testing parseProcNetRoute()", t, func() {
+		routes, err := parseProcNetRoute(strings.NewReader(`Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	FE01A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`))
+		So(err, ShouldBeNil)
+		So(len(routes), ShouldEqual, 1)
+		So(routes[0].String(), ShouldEqual, "192.168.1.254")
+	})
+}
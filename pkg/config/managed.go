@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Markers delimiting the section of ~/.ssh/config managed by assh, the
+// content outside the section is left untouched
+const (
+	managedBeginMarker = "# BEGIN assh"
+	managedEndMarker   = "# END assh"
+)
+
+// generatedHeader starts the files generated by assh, including the
+// ~/.ssh/config files written before the managed section
+const generatedHeader = "# This file was automatically generated by assh"
+
+// MergeManagedSection replaces the managed section of an existing file
+// (~/.ssh/config, /etc/hosts) by the generated content. A file without
+// section gets it appended, except a file fully generated by a previous assh
+// version which is replaced. It returns true if the section was edited manually
+// since it was written.
+func MergeManagedSection(existing, generated []byte) ([]byte, bool, error) {
+	if !bytes.HasSuffix(generated, []byte("\n")) {
+		generated = append(generated, '\n')
+	}
+	var section bytes.Buffer
+	fmt.Fprintf(&section, "%s (sha1 %s), changes in this section are overwritten\n", managedBeginMarker, managedChecksum(generated))
+	section.Write(generated)
+	fmt.Fprintln(&section, managedEndMarker)
+
+	lines := strings.SplitAfter(string(existing), "\n")
+	begin, end := -1, -1
+	for idx, line := range lines {
+		switch {
+		case strings.HasPrefix(line, managedBeginMarker):
+			if begin != -1 {
+				return nil, false, fmt.Errorf("line %d: duplicate %q marker", idx+1, managedBeginMarker)
+			}
+			begin = idx
+		case strings.HasPrefix(line, managedEndMarker):
+			if begin == -1 || end != -1 {
+				return nil, false, fmt.Errorf("line %d: unexpected %q marker", idx+1, managedEndMarker)
+			}
+			end = idx
+		}
+	}
+
+	switch {
+	case begin != -1 && end == -1:
+		return nil, false, fmt.Errorf("line %d: %q marker without %q", begin+1, managedBeginMarker, managedEndMarker)
+	case begin != -1:
+		content := strings.Join(lines[begin+1:end], "")
+		edited := !strings.Contains(lines[begin], fmt.Sprintf("(sha1 %s)", managedChecksum([]byte(content))))
+
+		var output bytes.Buffer
+		output.WriteString(strings.Join(lines[:begin], ""))
+		output.Write(section.Bytes())
+		output.WriteString(strings.Join(lines[end+1:], ""))
+		return output.Bytes(), edited, nil
+	case len(bytes.TrimSpace(existing)) == 0 || bytes.HasPrefix(existing, []byte(generatedHeader)):
+		return section.Bytes(), false, nil
+	default:
+		var output bytes.Buffer
+		output.Write(existing)
+		if !bytes.HasSuffix(existing, []byte("\n")) {
+			output.WriteByte('\n')
+		}
+		output.WriteByte('\n')
+		output.Write(section.Bytes())
+		return output.Bytes(), false, nil
+	}
+}
+
+func managedChecksum(content []byte) string {
+	hash := sha1.Sum(content)
+	return hex.EncodeToString(hash[:])
+}
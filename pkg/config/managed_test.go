@@ -0,0 +1,83 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMergeManagedSection(t *testing.T) {
+	Convey("Testing MergeManagedSection()", t, FailureContinues, func() {
+		generated := []byte("Host aaa\n  Port 22\n")
+		section := "# BEGIN assh (sha1 " + managedChecksum(generated) + "), changes in this section are overwritten\nHost aaa\n  Port 22\n# END assh\n"
+
+		Convey("Empty file", func() {
+			output, edited, err := MergeManagedSection(nil, generated)
+			So(err, ShouldBeNil)
+			So(edited, ShouldBeFalse)
+			So(string(output), ShouldEqual, section)
+		})
+
+		Convey("File generated by a previous version", func() {
+			output, _, err := MergeManagedSection([]byte(generatedHeader+" v2.4.1\nHost old\n"), generated)
+			So(err, ShouldBeNil)
+			So(string(output), ShouldEqual, section)
+		})
+
+		Convey("Hand-written file without section", func() {
+			output, _, err := MergeManagedSection([]byte("Host mine\n  User me"), generated)
+			So(err, ShouldBeNil)
+			So(string(output), ShouldEqual, "Host mine\n  User me\n\n"+section)
+		})
+
+		Convey("Existing section", func() {
+			existing := "Include ~/.orbstack/ssh/config\n\n" + section + "\n# Google Compute Engine Section\nHost gce\n"
+			output, edited, err := MergeManagedSection([]byte(existing), []byte("Host bbb\n"))
+			So(err, ShouldBeNil)
+			So(edited, ShouldBeFalse)
+			So(string(output), ShouldEqual, "Include ~/.orbstack/ssh/config\n\n# BEGIN assh (sha1 "+managedChecksum([]byte("Host bbb\n"))+"), changes in this section are overwritten\nHost bbb\n# END assh\n\n# Google Compute Engine Section\nHost gce\n")
+
+			_, edited, err = MergeManagedSection([]byte(strings.Replace(existing, "Port 22", "Port 2222", 1)), generated)
+			So(err, ShouldBeNil)
+			So(edited, ShouldBeTrue)
+		})
+
+		Convey("Unbalanced markers", func() {
+			_, _, err := MergeManagedSection([]byte("Host mine\n# BEGIN assh\nHost aaa\n"), generated)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `line 2: "# BEGIN assh" marker without "# END assh"`)
+
+			_, _, err = MergeManagedSection([]byte("# END assh\n"), generated)
+			So(err, ShouldNotBeNil)
+
+			_, _, err = MergeManagedSection([]byte(section+section), generated)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConfig_SaveSSHConfig(t *testing.T) {
+	Convey("Testing Config.SaveSSHConfig()", t, FailureContinues, func() {
+		file, err := ioutil.TempFile(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		file.Write([]byte("Host mine\n  User me\n"))
+		file.Close()
+
+		config := New()
+		config.sshConfigPath = file.Name()
+		So(config.LoadConfig(strings.NewReader("hosts:\n  aaa:\n    Port: 2222\n")), ShouldBeNil)
+		So(config.SaveSSHConfig(), ShouldBeNil)
+		So(config.SaveSSHConfig(), ShouldBeNil)
+
+		content, err := ioutil.ReadFile(file.Name())
+		So(err, ShouldBeNil)
+		So(string(content), ShouldStartWith, "Host mine\n  User me\n\n# BEGIN assh (sha1 ")
+		So(string(content), ShouldContainSubstring, "Host aaa\n  Port 2222\n")
+		So(string(content), ShouldEndWith, "# END assh\n")
+		So(strings.Count(string(content), managedBeginMarker), ShouldEqual, 1)
+	})
+}
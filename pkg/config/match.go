@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Kinds of HostMatch, sorted by precedence
+const (
+	MatchExactName = iota
+	MatchExactAlias
+	MatchPattern
+	MatchTemplate
+)
+
+var matchKindNames = map[int]string{
+	MatchExactName:  "exact name",
+	MatchExactAlias: "exact alias",
+	MatchPattern:    "pattern",
+	MatchTemplate:   "template",
+}
+
+// HostMatch is a host definition matching a target
+type HostMatch struct {
+	// Pattern is the host name, alias or pattern that matched the target
+	Pattern string
+	// Name is the name of the matching host or template in the configuration
+	Name string
+	// Kind is one of MatchExactName, MatchExactAlias, MatchPattern or MatchTemplate
+	Kind int
+	// Specificity is the number of literal characters in the pattern
+	Specificity int
+	// Wildcards is the number of wildcards in the pattern
+	Wildcards int
+	// Order is the declaration order of the host across includes, -1 if unknown
+	Order int
+	// Reason explains why the match was selected or not
+	Reason string
+
+	host *Host
+}
+
+// KindString returns a human readable version of Kind
+func (m *HostMatch) KindString() string {
+	return matchKindNames[m.Kind]
+}
+
+// IsPattern returns true if a host name is a glob pattern instead of a
+// single host
+func IsPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[!")
+}
+
+// patternSpecificity returns the number of literal characters and wildcards in a glob pattern
+func patternSpecificity(pattern string) (literals int, wildcards int) {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?':
+			wildcards++
+		case '[':
+			// a character class matches a single character
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				literals++
+				continue
+			}
+			wildcards++
+			i += end
+		case '\\':
+			i++
+			literals++
+		default:
+			literals++
+		}
+	}
+	return literals, wildcards
+}
+
+func (m *HostMatch) order() int {
+	if m.Order < 0 {
+		return math.MaxInt32
+	}
+	return m.Order
+}
+
+// compare returns a negative value if m has precedence over other, and the rule that decided it
+func (m *HostMatch) compare(other *HostMatch) (int, string) {
+	if m.Kind != other.Kind {
+		return m.Kind - other.Kind, fmt.Sprintf("%s takes precedence over %s", m.KindString(), other.KindString())
+	}
+	if m.Specificity != other.Specificity {
+		return other.Specificity - m.Specificity, "more literal characters"
+	}
+	if m.Wildcards != other.Wildcards {
+		return m.Wildcards - other.Wildcards, "fewer wildcards"
+	}
+	if m.order() != other.order() {
+		return m.order() - other.order(), "declared earlier"
+	}
+	return strings.Compare(m.Name, other.Name), "alphabetical order"
+}
+
+type hostMatches []*HostMatch
+
+func (hm hostMatches) Len() int      { return len(hm) }
+func (hm hostMatches) Swap(i, j int) { hm[i], hm[j] = hm[j], hm[i] }
+func (hm hostMatches) Less(i, j int) bool {
+	cmp, _ := hm[i].compare(hm[j])
+	return cmp < 0
+}
+
+// candidates returns every host (and template) definition matching name, sorted by precedence
+func (c *Config) candidates(name string, allowTemplate bool) ([]*HostMatch, error) {
+	matches := hostMatches{}
+	newMatch := func(pattern, hostName string, host *Host, kind int, order int) *HostMatch {
+		literals, wildcards := patternSpecificity(pattern)
+		return &HostMatch{
+			Pattern:     pattern,
+			Name:        hostName,
+			Kind:        kind,
+			Specificity: literals,
+			Wildcards:   wildcards,
+			Order:       order,
+			host:        host,
+		}
+	}
+
+	for hostName, host := range c.Hosts {
+		order, ok := c.hostsOrder[hostName]
+		if !ok {
+			order = -1
+		}
+		// a host is ranked by its most specific pattern matching name
+		var best *HostMatch
+		patterns := append([]string{hostName}, host.Aliases...)
+		for idx, pattern := range patterns {
+			var match *HostMatch
+			if pattern == name {
+				if idx == 0 {
+					match = newMatch(pattern, hostName, host, MatchExactName, order)
+				} else {
+					match = newMatch(pattern, hostName, host, MatchExactAlias, order)
+				}
+			} else {
+				matched, err := path.Match(pattern, name)
+				if err != nil {
+					return nil, err
+				}
+				if matched {
+					match = newMatch(pattern, hostName, host, MatchPattern, order)
+				}
+			}
+			if match == nil {
+				continue
+			}
+			if best == nil {
+				best = match
+			} else if cmp, _ := match.compare(best); cmp < 0 {
+				best = match
+			}
+		}
+		if best != nil {
+			matches = append(matches, best)
+		}
+	}
+
+	if allowTemplate {
+		for templateName, template := range c.Templates {
+			matched, err := path.Match(templateName, name)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				order, ok := c.templatesOrder[templateName]
+				if !ok {
+					order = -1
+				}
+				matches = append(matches, newMatch(templateName, templateName, template, MatchTemplate, order))
+			}
+		}
+	}
+
+	sort.Sort(matches)
+	return matches, nil
+}
+
+// ExplainHost returns every host definition matching the target sorted by
+// precedence, the first one is the one used by assh
+func (c *Config) ExplainHost(target string) ([]*HostMatch, error) {
+	name := strings.SplitN(target, "/", 2)[0]
+	matches, err := c.candidates(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, match := range matches {
+		if idx == 0 {
+			match.Reason = "selected"
+			if len(matches) > 1 {
+				_, rule := match.compare(matches[1])
+				match.Reason = fmt.Sprintf("selected: %s", rule)
+			}
+			continue
+		}
+		_, rule := matches[0].compare(match)
+		match.Reason = fmt.Sprintf("%q wins: %s", matches[0].Pattern, rule)
+	}
+	return matches, nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPatternSpecificity(t *testing.T) {
+	Convey("Testing patternSpecificity()", t, FailureContinues, func() {
+		literals, wildcards := patternSpecificity("abc")
+		So(literals, ShouldEqual, 3)
+		So(wildcards, ShouldEqual, 0)
+
+		literals, wildcards = patternSpecificity("*.abc")
+		So(literals, ShouldEqual, 4)
+		So(wildcards, ShouldEqual, 1)
+
+		literals, wildcards = patternSpecificity("toto[1-5]toto")
+		So(literals, ShouldEqual, 8)
+		So(wildcards, ShouldEqual, 1)
+
+		literals, wildcards = patternSpecificity("a?c*")
+		So(literals, ShouldEqual, 2)
+		So(wildcards, ShouldEqual, 2)
+	})
+}
+
+func TestConfig_ExplainHost(t *testing.T) {
+	Convey("Testing Config.ExplainHost()", t, FailureContinues, func() {
+		config := New()
+		err := config.LoadConfig(strings.NewReader(`
+hosts:
+  "*.prod":
+    User: prod
+  "web-*.prod":
+    User: web
+  "*-1.prod":
+    User: one
+  "web-1.prod":
+    User: exact
+  other:
+    Aliases:
+    - web-2.prod
+`))
+		So(err, ShouldBeNil)
+
+		matches, err := config.ExplainHost("web-1.prod")
+		So(err, ShouldBeNil)
+		So(len(matches), ShouldEqual, 4)
+		So(matches[0].Pattern, ShouldEqual, "web-1.prod")
+		So(matches[0].Kind, ShouldEqual, MatchExactName)
+		So(matches[0].Reason, ShouldEqual, "selected: exact name takes precedence over pattern")
+		So(matches[1].Pattern, ShouldEqual, "web-*.prod")
+		So(matches[2].Pattern, ShouldEqual, "*-1.prod")
+		So(matches[2].Reason, ShouldEqual, `"web-1.prod" wins: exact name takes precedence over pattern`)
+		So(matches[3].Pattern, ShouldEqual, "*.prod")
+
+		matches, err = config.ExplainHost("web-2.prod")
+		So(err, ShouldBeNil)
+		So(matches[0].Name, ShouldEqual, "other")
+		So(matches[0].Kind, ShouldEqual, MatchExactAlias)
+
+		matches, err = config.ExplainHost("web-3.prod/gateway")
+		So(err, ShouldBeNil)
+		So(len(matches), ShouldEqual, 2)
+		So(matches[0].Pattern, ShouldEqual, "web-*.prod")
+		So(matches[0].Reason, ShouldEqual, "selected: more literal characters")
+
+		Convey("Ties are broken by declaration order", func() {
+			config := New()
+			err := config.LoadConfig(strings.NewReader(`
+hosts:
+  "b-*":
+    User: first
+  "*-a":
+    User: second
+`))
+			So(err, ShouldBeNil)
+			for i := 0; i < 10; i++ {
+				host, err := config.GetHost("b-a")
+				So(err, ShouldBeNil)
+				So(host.User, ShouldEqual, "first")
+			}
+			matches, err := config.ExplainHost("b-a")
+			So(err, ShouldBeNil)
+			So(matches[0].Reason, ShouldEqual, "selected: declared earlier")
+		})
+
+		Convey("A host is ranked by its most specific pattern", func() {
+			config := New()
+			err := config.LoadConfig(strings.NewReader(`
+hosts:
+  "?.corp":
+    User: single
+  "*.corp":
+    User: wildcard
+    Aliases:
+    - x.corp
+`))
+			So(err, ShouldBeNil)
+			matches, err := config.ExplainHost("x.corp")
+			So(err, ShouldBeNil)
+			So(len(matches), ShouldEqual, 2)
+			So(matches[0].Name, ShouldEqual, "*.corp")
+			So(matches[0].Pattern, ShouldEqual, "x.corp")
+			So(matches[0].Kind, ShouldEqual, MatchExactAlias)
+			So(matches[1].Name, ShouldEqual, "?.corp")
+
+			host, err := config.GetHost("x.corp")
+			So(err, ShouldBeNil)
+			So(host.User, ShouldEqual, "wildcard")
+		})
+	})
+}
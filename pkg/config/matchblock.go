@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+)
+
+// Positions of a MatchBlock relative to the generated Host blocks
+const (
+	MatchPositionBefore = "before"
+	MatchPositionAfter  = "after"
+)
+
+// MatchBlock is an entry of the `matches` section, emitted as an OpenSSH
+// `Match` block; all the criteria must match for the options to apply
+type MatchBlock struct {
+	Canonical    bool                      `yaml:"canonical,omitempty" json:"Canonical,omitempty"`
+	Final        bool                      `yaml:"final,omitempty" json:"Final,omitempty"`
+	All          bool                      `yaml:"all,omitempty" json:"All,omitempty"`
+	Host         composeyaml.Stringorslice `yaml:"host,omitempty,flow" json:"Host,omitempty"`
+	OriginalHost composeyaml.Stringorslice `yaml:"originalhost,omitempty,flow" json:"OriginalHost,omitempty"`
+	User         composeyaml.Stringorslice `yaml:"user,omitempty,flow" json:"User,omitempty"`
+	LocalUser    composeyaml.Stringorslice `yaml:"localuser,omitempty,flow" json:"LocalUser,omitempty"`
+	Exec         string                    `yaml:"exec,omitempty,flow" json:"Exec,omitempty"`
+
+	// Position is "before" or "after" (default) the Host blocks, with
+	// OpenSSH the first obtained value of an option wins
+	Position string `yaml:"position,omitempty,flow" json:"Position,omitempty"`
+	Options  Host   `yaml:"options,omitempty,flow" json:"Options,omitempty"`
+}
+
+// matchExec runs the command of an `exec` criterion, it matches if the command exits successfully
+var matchExec = func(command string) bool {
+	return exec.Command("/bin/sh", "-c", command).Run() == nil
+}
+
+// Criteria returns the OpenSSH criteria of the block, i.e: `host *.corp user root`
+func (m *MatchBlock) Criteria() string {
+	criteria := []string{}
+	for _, criterion := range []struct {
+		keyword  string
+		patterns []string
+	}{
+		{"host", m.Host},
+		{"originalhost", m.OriginalHost},
+		{"user", m.User},
+		{"localuser", m.LocalUser},
+	} {
+		if len(criterion.patterns) > 0 {
+			criteria = append(criteria, criterion.keyword, strings.Join(criterion.patterns, ","))
+		}
+	}
+	if m.Exec != "" {
+		criteria = append(criteria, "exec", quoteSSHConfig(m.Exec))
+	}
+
+	// `all` must appear alone or right after canonical and final
+	if m.All || len(criteria) == 0 && !m.Canonical && !m.Final {
+		criteria = append([]string{"all"}, criteria...)
+	}
+	if m.Final {
+		criteria = append([]string{"final"}, criteria...)
+	}
+	if m.Canonical {
+		criteria = append([]string{"canonical"}, criteria...)
+	}
+	return strings.Join(criteria, " ")
+}
+
+// quoteSSHConfig wraps value in double quotes, the escapes are not supported
+// by every OpenSSH version so the values containing a double quote are
+// rejected by validate
+func quoteSSHConfig(value string) string {
+	return `"` + value + `"`
+}
+
+// validate returns an error if the block cannot be written as a valid
+// OpenSSH `Match` block
+func (m *MatchBlock) validate() error {
+	if strings.ContainsAny(m.Exec, "\"\r\n") {
+		return fmt.Errorf("match exec %q: double quotes and newlines are not supported by ssh_config", m.Exec)
+	}
+	return nil
+}
+
+// Matches returns true if the criteria match the host; `canonical` matches
+// when hostname canonicalization is enabled and `final` always matches since
+// assh computes the final configuration
+func (m *MatchBlock) Matches(host *Host, originalHost string) bool {
+	if m.Canonical && !BoolVal(host.CanonicalizeHostname) && strings.ToLower(host.CanonicalizeHostname) != "always" {
+		return false
+	}
+
+	hostname := host.HostName
+	if hostname == "" {
+		hostname = originalHost
+	}
+	for _, criterion := range []struct {
+		patterns []string
+		value    string
+	}{
+		{m.Host, hostname},
+		{m.OriginalHost, originalHost},
+		{m.User, host.remoteUser()},
+		{m.LocalUser, localUsername()},
+	} {
+		if len(criterion.patterns) > 0 && !matchPatternList(criterion.patterns, criterion.value) {
+			return false
+		}
+	}
+
+	if m.Exec != "" {
+		computed := host.Clone()
+		computed.HostName = hostname
+		computed.inputName = originalHost
+		if !matchExec(computed.ExpandString(m.Exec)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPatternList implements the OpenSSH pattern lists: comma-separated
+// patterns, a pattern prefixed with `!` is a negation which prevents the match
+func matchPatternList(patterns []string, value string) bool {
+	matched := false
+	for _, entry := range patterns {
+		for _, pattern := range strings.Split(entry, ",") {
+			negated := strings.HasPrefix(pattern, "!")
+			if ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), value); ok {
+				if negated {
+					return false
+				}
+				matched = true
+			}
+		}
+	}
+	return matched
+}
+
+// WriteSSHConfigTo writes the block as an OpenSSH `Match` block, the assh
+// specific options are written as comments
+func (m *MatchBlock) WriteSSHConfigTo(w io.Writer) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Match %s\n", m.Criteria())
+	for _, option := range m.Options.Options() {
+		fmt.Fprintf(w, "  %s %s\n", option.Name, option.Value)
+	}
+	if m.Options.HostName != "" {
+		fmt.Fprintf(w, "  # HostName: %s\n", m.Options.HostName)
+	}
+	if m.Options.ProxyCommand != "" {
+		fmt.Fprintf(w, "  # ProxyCommand %s\n", m.Options.ProxyCommand)
+	}
+	if len(m.Options.Gateways) > 0 {
+		fmt.Fprintf(w, "  # Gateways: [%s]\n", strings.Join(m.Options.Gateways, ", "))
+	}
+	return nil
+}
+
+func (c *Config) hasMatchBlocks(position string) bool {
+	for idx := range c.Matches {
+		if c.Matches[idx].position() == position {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMatchBlocks writes the match blocks declared at position
+func (c *Config) writeMatchBlocks(w io.Writer, position string) error {
+	for idx := range c.Matches {
+		block := &c.Matches[idx]
+		if block.position() != position {
+			continue
+		}
+		if err := block.WriteSSHConfigTo(w); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (m *MatchBlock) position() string {
+	if strings.ToLower(m.Position) == MatchPositionBefore {
+		return MatchPositionBefore
+	}
+	return MatchPositionAfter
+}
+
+// GetConnectHost returns the host used by `assh connect`, computed like
+// GetHostSafe with the options of the matching blocks applied following the
+// OpenSSH precedence: the blocks placed before the Host blocks override the
+// host options, the ones placed after only fill the unset options
+func (c *Config) GetConnectHost(name string) (*Host, []*MatchBlock, error) {
+	host, err := c.getHostByPath(name, true, false, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	originalHost := strings.SplitN(name, "/", 2)[0]
+	criteriaHost := host.Clone()
+	if criteriaHost.User == "" {
+		criteriaHost.User = c.Defaults.User
+	}
+	if criteriaHost.CanonicalizeHostname == "" {
+		criteriaHost.CanonicalizeHostname = c.Defaults.CanonicalizeHostname
+	}
+
+	matched := []*MatchBlock{}
+	before := Host{}
+	after := []*MatchBlock{}
+	for idx := range c.Matches {
+		block := &c.Matches[idx]
+		if !block.Matches(criteriaHost, originalHost) {
+			continue
+		}
+		matched = append(matched, block)
+		if block.position() == MatchPositionBefore {
+			fillHost(&before, &block.Options)
+		} else {
+			after = append(after, block)
+		}
+	}
+
+	overlayHost(host, &before)
+	for _, block := range after {
+		fillHost(host, &block.Options)
+	}
+
+	finalizeHost(host, c, originalHost)
+	if err := renderVars(host, c.hostVars(host)); err != nil {
+		return nil, nil, fmt.Errorf("host %q: %v", originalHost, err)
+	}
+	return host, matched, nil
+}
+
+// fillHost sets the empty fields of host with the fields of values
+func fillHost(host, values *Host) {
+	hostValue := reflect.ValueOf(host).Elem()
+	valuesValue := reflect.ValueOf(values).Elem()
+	for i := 0; i < valuesValue.NumField(); i++ {
+		if hostValue.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		field := hostValue.Field(i)
+		if !reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			continue
+		}
+		field.Set(valuesValue.Field(i))
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testMatchesConfig = `hosts:
+  aaa:
+    HostName: aaa.corp
+    User: bob
+  bbb:
+    HostName: bbb.example.com
+matches:
+- host: "*.corp,!secret.corp"
+  user: bob
+  options:
+    User: alice
+    Port: 2222
+    Gateways: bastion
+- exec: test -f /tmp/vpn-%h
+  position: before
+  options:
+    User: vpn
+- canonical: true
+  all: true
+  options:
+    ForwardAgent: yes
+- originalhost: bbb
+  localuser: "*"
+  options:
+    Port: 2022
+defaults:
+  Port: 22
+`
+
+func TestMatchBlock_Criteria(t *testing.T) {
+	Convey("Testing MatchBlock.Criteria()", t, FailureContinues, func() {
+		So((&MatchBlock{}).Criteria(), ShouldEqual, "all")
+		So((&MatchBlock{Final: true}).Criteria(), ShouldEqual, "final")
+		So((&MatchBlock{Canonical: true, All: true}).Criteria(), ShouldEqual, "canonical all")
+		So((&MatchBlock{
+			Host:      composeyaml.Stringorslice{"*.corp", "!secret.corp"},
+			User:      composeyaml.Stringorslice{"root"},
+			LocalUser: composeyaml.Stringorslice{"alice"},
+			Exec:      "nc -z %h 22",
+		}).Criteria(), ShouldEqual, `host *.corp,!secret.corp user root localuser alice exec "nc -z %h 22"`)
+		So((&MatchBlock{Exec: "test -d ~/.ssh\\ctl\t&& echo é"}).Criteria(), ShouldEqual, "exec \"test -d ~/.ssh\\ctl\t&& echo é\"")
+
+		var buffer bytes.Buffer
+		err := (&MatchBlock{Exec: `grep -q "corp" /etc/resolv.conf`}).WriteSSHConfigTo(&buffer)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `match exec "grep -q \"corp\" /etc/resolv.conf": double quotes and newlines are not supported by ssh_config`)
+		So(buffer.String(), ShouldEqual, "")
+	})
+}
+
+func TestMatchPatternList(t *testing.T) {
+	Convey("Testing matchPatternList()", t, FailureContinues, func() {
+		So(matchPatternList([]string{"*.corp"}, "aaa.corp"), ShouldBeTrue)
+		So(matchPatternList([]string{"*.corp,!secret.corp"}, "secret.corp"), ShouldBeFalse)
+		So(matchPatternList([]string{"aaa", "bbb"}, "bbb"), ShouldBeTrue)
+		So(matchPatternList([]string{"!aaa"}, "bbb"), ShouldBeFalse)
+	})
+}
+
+func TestConfig_Matches(t *testing.T) {
+	Convey("Testing the matches section", t, FailureContinues, func() {
+		previousExec := matchExec
+		defer func() { matchExec = previousExec }()
+		executed := []string{}
+		vpn := false
+		matchExec = func(command string) bool {
+			executed = append(executed, command)
+			return vpn
+		}
+
+		config := New()
+		So(config.LoadConfig(strings.NewReader(testMatchesConfig)), ShouldBeNil)
+		So(len(config.Matches), ShouldEqual, 4)
+
+		Convey("GetConnectHost()", func() {
+			host, matches, err := config.GetConnectHost("aaa")
+			So(err, ShouldBeNil)
+			So(len(matches), ShouldEqual, 1)
+			So(host.User, ShouldEqual, "bob")
+			So(host.Port, ShouldEqual, "2222")
+			So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+			So(executed, ShouldResemble, []string{"test -f /tmp/vpn-aaa.corp"})
+
+			vpn = true
+			host, matches, err = config.GetConnectHost("aaa")
+			So(err, ShouldBeNil)
+			So(len(matches), ShouldEqual, 2)
+			So(host.User, ShouldEqual, "vpn")
+
+			host, _, err = config.GetConnectHost("bbb")
+			So(err, ShouldBeNil)
+			So(host.User, ShouldEqual, "vpn")
+			So(host.Port, ShouldEqual, "2022")
+			So(host.ForwardAgent, ShouldEqual, "")
+
+			vpn = false
+			host, _, err = config.GetConnectHost("ccc")
+			So(err, ShouldBeNil)
+			So(host.User, ShouldEqual, "")
+			So(host.Port, ShouldEqual, "22")
+		})
+
+		Convey("Canonical", func() {
+			config.Defaults.CanonicalizeHostname = "yes"
+			host, _, err := config.GetConnectHost("bbb")
+			So(err, ShouldBeNil)
+			So(host.ForwardAgent, ShouldEqual, "yes")
+		})
+
+		Convey("Matches of every file are kept", func() {
+			So(config.LoadConfig(strings.NewReader("matches:\n- final: true\n  options:\n    User: last\n")), ShouldBeNil)
+			So(len(config.Matches), ShouldEqual, 5)
+		})
+
+		Convey("WriteSSHConfigTo()", func() {
+			var buffer bytes.Buffer
+			So(config.WriteSSHConfigTo(&buffer), ShouldBeNil)
+			output := buffer.String()
+			So(output, ShouldContainSubstring, `# match-based configuration, before the hosts
+Match exec "test -f /tmp/vpn-%h"
+  User vpn
+
+# host-based configuration
+`)
+			So(output, ShouldContainSubstring, `# match-based configuration
+Match host *.corp,!secret.corp user bob
+  Port 2222
+  User alice
+  # Gateways: [bastion]
+
+Match canonical all
+  ForwardAgent yes
+
+Match originalhost bbb localuser *
+  Port 2022
+
+# global configuration
+`)
+			So(strings.Index(output, "Host bbb\n"), ShouldBeLessThan, strings.Index(output, "Match host"))
+		})
+	})
+}
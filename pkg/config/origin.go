@@ -0,0 +1,211 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/flexyaml"
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// Origin is the location where a host, a template or an option is defined
+type Origin struct {
+	File string `json:"file"`
+	Line int    `json:"line,omitempty"`
+}
+
+// String returns a "file:line" representation of the origin
+func (o Origin) String() string {
+	if o.Line > 0 {
+		return fmt.Sprintf("%s:%d", o.File, o.Line)
+	}
+	return o.File
+}
+
+// Origins maps a definition path to its origin, paths are "hosts/<name>",
+// "templates/<name>", "defaults", optionally followed by an option name
+// (i.e: "hosts/foo/HostName")
+type Origins map[string]Origin
+
+// hostFieldNames maps the lowercased yaml keys of Host to their field name
+var hostFieldNames = map[string]string{}
+
+func init() {
+	hostType := reflect.TypeOf(Host{})
+	for i := 0; i < hostType.NumField(); i++ {
+		field := hostType.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.PkgPath != "" || key == "" || key == "-" {
+			continue
+		}
+		hostFieldNames[strings.ToLower(key)] = field.Name
+	}
+}
+
+// OriginOf returns the origin of a host, template or defaults option
+func (c *Config) OriginOf(path ...string) (Origin, bool) {
+	origin, found := c.Origins[strings.Join(path, "/")]
+	return origin, found
+}
+
+// Redefinitions returns the conflicting redefinitions found while loading the configuration
+func (c *Config) Redefinitions() Diagnostics {
+	return c.redefinitions
+}
+
+// definitions is a snapshot of the hosts, templates and defaults taken before
+// loading a file, used to detect the redefinitions made by the file
+type definitions struct {
+	hosts     map[string]*Host
+	templates map[string]*Host
+	defaults  Host
+}
+
+func (c *Config) snapshotDefinitions() definitions {
+	snapshot := definitions{
+		hosts:     make(map[string]*Host),
+		templates: make(map[string]*Host),
+		defaults:  c.Defaults,
+	}
+	for name, host := range c.Hosts {
+		snapshot.hosts[name] = host
+	}
+	for name, template := range c.Templates {
+		snapshot.templates[name] = template
+	}
+	// hooks are decoded in place
+	if c.Defaults.Hooks != nil {
+		hooks := *c.Defaults.Hooks
+		snapshot.defaults.Hooks = &hooks
+	}
+	return snapshot
+}
+
+// recordOrigins keeps track of the file and line defining every host,
+// template and defaults option of the document, the order in which hosts and templates
+// are declared across the loaded files (a redefinition keeps its first
+// position), and warns about conflicting redefinitions
+func (c *Config) recordOrigins(doc *flexyaml.Document, filename string, trackLines bool, previous definitions) error {
+	var declarations struct {
+		Hosts     yaml.MapSlice `yaml:"hosts"`
+		Templates yaml.MapSlice `yaml:"templates"`
+		Defaults  yaml.MapSlice `yaml:"defaults"`
+	}
+	if err := doc.Decode(&declarations); err != nil {
+		return err
+	}
+
+	if c.Origins == nil {
+		c.Origins = make(Origins)
+	}
+	if c.hostsOrder == nil {
+		c.hostsOrder = make(map[string]int)
+	}
+	if c.templatesOrder == nil {
+		c.templatesOrder = make(map[string]int)
+	}
+
+	lines := map[string]int{}
+	if trackLines {
+		lines = doc.KeyLines()
+	}
+	originOf := func(keys ...string) Origin {
+		return Origin{File: filename, Line: lines[strings.ToLower(strings.Join(keys, "/"))]}
+	}
+
+	// origins are only tracked for files, i.e: not for LoadConfig streams
+	track := filename != ""
+
+	sections := []struct {
+		name     string
+		items    yaml.MapSlice
+		current  HostsMap
+		previous map[string]*Host
+		order    map[string]int
+	}{
+		{"hosts", declarations.Hosts, c.Hosts, previous.hosts, c.hostsOrder},
+		{"templates", declarations.Templates, c.Templates, previous.templates, c.templatesOrder},
+	}
+	for _, section := range sections {
+		for _, item := range section.items {
+			name := fmt.Sprintf("%v", item.Key)
+			if _, found := section.order[name]; !found {
+				section.order[name] = len(section.order)
+			}
+
+			if !track {
+				continue
+			}
+			key := section.name + "/" + name
+			origin := originOf(section.name, name)
+			if before, found := section.previous[name]; found {
+				if !sameDefinition(before, section.current[name]) {
+					c.addRedefinition(origin, "%s %q overrides the definition from %s", strings.TrimSuffix(section.name, "s"), name, c.Origins[key])
+				}
+				// the whole definition is replaced
+				for path := range c.Origins {
+					if strings.HasPrefix(path, key+"/") {
+						delete(c.Origins, path)
+					}
+				}
+			}
+			c.Origins[key] = origin
+
+			fields, _ := item.Value.(yaml.MapSlice)
+			for _, field := range fields {
+				if fieldName, found := hostFieldNames[strings.ToLower(fmt.Sprintf("%v", field.Key))]; found {
+					c.Origins[key+"/"+fieldName] = originOf(section.name, name, fmt.Sprintf("%v", field.Key))
+				}
+			}
+		}
+	}
+
+	if !track {
+		return nil
+	}
+
+	// defaults are merged field by field
+	if declarations.Defaults != nil {
+		if _, found := c.Origins["defaults"]; !found {
+			c.Origins["defaults"] = originOf("defaults")
+		}
+	}
+	before := reflect.ValueOf(previous.defaults)
+	after := reflect.ValueOf(c.Defaults)
+	for _, field := range declarations.Defaults {
+		fieldName, found := hostFieldNames[strings.ToLower(fmt.Sprintf("%v", field.Key))]
+		if !found {
+			continue
+		}
+		key := "defaults/" + fieldName
+		origin := originOf("defaults", fmt.Sprintf("%v", field.Key))
+		if previousOrigin, found := c.Origins[key]; found {
+			if !reflect.DeepEqual(before.FieldByName(fieldName).Interface(), after.FieldByName(fieldName).Interface()) {
+				c.addRedefinition(origin, "defaults option %q overrides the value from %s", fieldName, previousOrigin)
+			}
+		}
+		c.Origins[key] = origin
+	}
+	return nil
+}
+
+func (c *Config) addRedefinition(origin Origin, format string, args ...interface{}) {
+	diagnostic := Diagnostic{
+		File:     origin.File,
+		Line:     origin.Line,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	Logger.Warnf("%s: %s", origin, diagnostic.Message)
+	c.redefinitions = append(c.redefinitions, diagnostic)
+}
+
+// sameDefinition returns true if both hosts have the same exported fields
+func sameDefinition(a, b *Host) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig_Origins(t *testing.T) {
+	Convey("Testing Config origins", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		main := filepath.Join(dir, "assh.yml")
+		included := filepath.Join(dir, "included.yml")
+		So(ioutil.WriteFile(main, []byte(`hosts:
+  aaa:
+    HostName: 1.2.3.4
+    User: root
+  bbb:
+    HostName: 5.6.7.8
+templates:
+  tpl:
+    Port: 2222
+defaults:
+  User: toor
+  Port: 22
+includes:
+- `+included+`
+`), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(included, []byte(`hosts:
+  aaa:
+    HostName: 4.3.2.1
+  bbb:
+    HostName: 5.6.7.8
+  ccc:
+    Port: 24
+defaults:
+  Port: 22
+  User: admin
+`), 0644), ShouldBeNil)
+
+		config := New()
+		So(config.LoadFile(main), ShouldBeNil)
+
+		Convey("Hosts and options origins", func() {
+			origin, found := config.OriginOf("hosts", "aaa")
+			So(found, ShouldBeTrue)
+			So(origin, ShouldResemble, Origin{File: included, Line: 2})
+
+			origin, found = config.OriginOf("hosts", "aaa", "HostName")
+			So(found, ShouldBeTrue)
+			So(origin.String(), ShouldEqual, included+":3")
+
+			// the previous definition of aaa is discarded
+			_, found = config.OriginOf("hosts", "aaa", "User")
+			So(found, ShouldBeFalse)
+
+			origin, _ = config.OriginOf("hosts", "ccc", "Port")
+			So(origin, ShouldResemble, Origin{File: included, Line: 7})
+
+			origin, _ = config.OriginOf("templates", "tpl", "Port")
+			So(origin, ShouldResemble, Origin{File: main, Line: 9})
+		})
+
+		Convey("Defaults origins", func() {
+			origin, _ := config.OriginOf("defaults")
+			So(origin, ShouldResemble, Origin{File: main, Line: 10})
+
+			origin, _ = config.OriginOf("defaults", "User")
+			So(origin, ShouldResemble, Origin{File: included, Line: 10})
+
+			origin, _ = config.OriginOf("defaults", "Port")
+			So(origin, ShouldResemble, Origin{File: included, Line: 9})
+		})
+
+		Convey("Conflicting redefinitions", func() {
+			redefinitions := []string{}
+			for _, diagnostic := range config.Redefinitions() {
+				redefinitions = append(redefinitions, diagnostic.String())
+			}
+			So(redefinitions, ShouldResemble, []string{
+				included + ":2: warning: host \"aaa\" overrides the definition from " + main + ":2",
+				included + ":10: warning: defaults option \"User\" overrides the value from " + main + ":11",
+			})
+		})
+	})
+}
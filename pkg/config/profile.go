@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var asshProfile = ""
+
+// profileNameRegex matches the profile names, they are passed unquoted to
+// `assh connect` by the generated ProxyCommand
+var profileNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// SetASSHProfile sets the profile applied by Open, the generated ProxyCommand
+// passes it to `assh connect` so the connections use the same profile
+func SetASSHProfile(name string) {
+	asshProfile = name
+}
+
+// Profile is a named set of definitions overlaying the defaults, the templates and the hosts
+type Profile struct {
+	Defaults  Host     `yaml:"defaults,omitempty,flow" json:"defaults,omitempty"`
+	Templates HostsMap `yaml:"templates,omitempty,flow" json:"templates,omitempty"`
+	Hosts     HostsMap `yaml:"hosts,omitempty,flow" json:"hosts,omitempty"`
+}
+
+// ProfileNames returns the names of the declared profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := []string{}
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkProfileNames returns an error for the first invalid profile name
+func (c *Config) checkProfileNames() error {
+	for _, name := range c.ProfileNames() {
+		if err := checkProfileName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkProfileName(name string) error {
+	if !profileNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, only letters, digits, '_', '.' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// ActiveProfile returns the name of the applied profile
+func (c *Config) ActiveProfile() string {
+	return c.activeProfile
+}
+
+// ApplyProfile overlays the defaults, templates and hosts of a profile on
+// the configuration, the fields set in the profile replace the existing ones
+// and the hosts and templates only defined in the profile are added
+func (c *Config) ApplyProfile(name string) error {
+	if err := checkProfileName(name); err != nil {
+		return err
+	}
+	profile, found := c.Profiles[name]
+	if !found {
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	if c.activeProfile != "" {
+		return fmt.Errorf("profile %q is already applied", c.activeProfile)
+	}
+
+	if profile != nil {
+		overlayHost(&c.Defaults, &profile.Defaults)
+		for _, section := range []struct {
+			overlay HostsMap
+			current HostsMap
+		}{
+			{profile.Templates, c.Templates},
+			{profile.Hosts, c.Hosts},
+		} {
+			for hostName, overlay := range section.overlay {
+				if overlay == nil {
+					continue
+				}
+				if host, found := section.current[hostName]; found {
+					overlayHost(host, overlay)
+				} else {
+					section.current[hostName] = overlay
+				}
+			}
+		}
+	}
+
+	c.activeProfile = name
+	c.applyMissingNames()
+	return nil
+}
+
+// overlayHost replaces the fields of host by the non-empty fields of overlay
+func overlayHost(host, overlay *Host) {
+	hostValue := reflect.ValueOf(host).Elem()
+	overlayValue := reflect.ValueOf(overlay).Elem()
+	for i := 0; i < overlayValue.NumField(); i++ {
+		if hostValue.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		field := overlayValue.Field(i)
+		if reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()) {
+			continue
+		}
+		hostValue.Field(i).Set(field)
+	}
+}
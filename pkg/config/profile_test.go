@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testProfilesConfig = `hosts:
+  aaa:
+    HostName: 1.2.3.4
+    Gateways: office-gw
+  bbb:
+    HostName: 5.6.7.8
+    Inherits: tpl
+templates:
+  tpl:
+    User: bob
+defaults:
+  User: root
+  ControlPath: ~/.ssh/cm/%h.sock
+profiles:
+  travel:
+    defaults:
+      ControlPath: /tmp/cm-%h.sock
+    templates:
+      tpl:
+        User: traveler
+    hosts:
+      aaa:
+        Gateways: [vpn, direct]
+      vpn:
+        HostName: vpn.example.com
+  office:
+`
+
+func TestConfig_ApplyProfile(t *testing.T) {
+	Convey("Testing Config.ApplyProfile()", t, FailureContinues, func() {
+		config := New()
+		So(config.LoadConfig(strings.NewReader(testProfilesConfig)), ShouldBeNil)
+		So(config.ProfileNames(), ShouldResemble, []string{"office", "travel"})
+
+		Convey("Overlay", func() {
+			So(config.ApplyProfile("travel"), ShouldBeNil)
+			So(config.ActiveProfile(), ShouldEqual, "travel")
+
+			So(config.Defaults.User, ShouldEqual, "root")
+			So(config.Defaults.ControlPath, ShouldEqual, "/tmp/cm-%h.sock")
+
+			host, err := config.GetHost("aaa")
+			So(err, ShouldBeNil)
+			So(host.HostName, ShouldEqual, "1.2.3.4")
+			So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"vpn", "direct"})
+
+			host, err = config.GetHost("bbb")
+			So(err, ShouldBeNil)
+			So(host.User, ShouldEqual, "traveler")
+
+			host, err = config.GetHost("vpn")
+			So(err, ShouldBeNil)
+			So(host.HostName, ShouldEqual, "vpn.example.com")
+
+			So(config.ApplyProfile("travel"), ShouldNotBeNil)
+		})
+
+		Convey("Empty profile", func() {
+			So(config.ApplyProfile("office"), ShouldBeNil)
+			host, err := config.GetHost("aaa")
+			So(err, ShouldBeNil)
+			So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"office-gw"})
+		})
+
+		Convey("Unknown profile", func() {
+			err := config.ApplyProfile("home")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `unknown profile "home" (available: office, travel)`)
+		})
+
+		Convey("Invalid profile name", func() {
+			err := config.ApplyProfile("travel;id")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `invalid profile name "travel;id", only letters, digits, '_', '.' and '-' are allowed`)
+
+			config := New()
+			err = config.LoadConfig(strings.NewReader("profiles:\n  \"a b\":\n    defaults:\n      User: bob\n"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `invalid profile name "a b", only letters, digits, '_', '.' and '-' are allowed`)
+		})
+
+		Convey("Generated ssh config", func() {
+			SetASSHProfile("travel")
+			defer SetASSHProfile("")
+			So(config.ApplyProfile("travel"), ShouldBeNil)
+
+			var buffer bytes.Buffer
+			So(config.WriteSSHConfigTo(&buffer), ShouldBeNil)
+			So(buffer.String(), ShouldContainSubstring, "# profile: travel\n")
+			So(buffer.String(), ShouldContainSubstring, "ProxyCommand assh --profile=travel connect --port=%p %h\n")
+		})
+	})
+
+	Convey("Testing Open() with a profile", t, FailureContinues, func() {
+		file, err := ioutil.TempFile(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		file.Write([]byte(testProfilesConfig))
+		file.Close()
+
+		SetASSHProfile("travel")
+		defer SetASSHProfile("")
+		config, err := Open(file.Name())
+		So(err, ShouldBeNil)
+		So(config.ActiveProfile(), ShouldEqual, "travel")
+
+		SetASSHProfile("home")
+		_, err = Open(file.Name())
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,368 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/hooks"
+)
+
+// yesNo is the enum of the yes/no options, YAML booleans are accepted too
+var yesNo = []interface{}{"yes", "no", true, false}
+
+// schemaEnums are the accepted values of the options
+var schemaEnums = map[string][]interface{}{
+	"UntrustedIncludes":                {UntrustedIncludesRefuse, UntrustedIncludesStrip},
+	"AddressFamily":                    {"any", "inet", "inet6"},
+	"AskPassGUI":                       yesNo,
+	"BatchMode":                        yesNo,
+	"CanonicalizeFallbackLocal":        yesNo,
+	"CanonicalizeHostname":             {"yes", "no", "always", true, false},
+	"ChallengeResponseAuthentication":  yesNo,
+	"CheckHostIP":                      yesNo,
+	"ClearAllForwardings":              yesNo,
+	"Compression":                      yesNo,
+	"ControlMaster":                    {"yes", "no", "ask", "auto", "autoask", true, false},
+	"ControlMasterMkdir":               yesNo,
+	"EnableSSHKeysign":                 yesNo,
+	"ExitOnForwardFailure":             yesNo,
+	"FingerprintHash":                  {"md5", "sha256"},
+	"ForwardX11":                       yesNo,
+	"ForwardX11Trusted":                yesNo,
+	"GatewayPorts":                     yesNo,
+	"GSSAPIAuthentication":             yesNo,
+	"GSSAPIDelegateCredentials":        yesNo,
+	"GSSAPIKeyExchange":                yesNo,
+	"GSSAPIRenewalForcesRekey":         yesNo,
+	"GSSAPITrustDns":                   yesNo,
+	"HashKnownHosts":                   yesNo,
+	"HostbasedAuthentication":          yesNo,
+	"IdentitiesOnly":                   yesNo,
+	"KbdInteractiveAuthentication":     yesNo,
+	"KeychainIntegration":              yesNo,
+	"LogLevel":                         {"QUIET", "FATAL", "ERROR", "INFO", "VERBOSE", "DEBUG", "DEBUG1", "DEBUG2", "DEBUG3"},
+	"NoHostAuthenticationForLocalhost": yesNo,
+	"PasswordAuthentication":           yesNo,
+	"PermitLocalCommand":               yesNo,
+	"ProxyUseFdpass":                   yesNo,
+	"PubkeyAuthentication":             yesNo,
+	"RequestTTY":                       {"yes", "no", "force", "auto", true, false},
+	"RhostsRSAAuthentication":          yesNo,
+	"RSAAuthentication":                yesNo,
+	"StreamLocalBindUnlink":            yesNo,
+	"StrictHostKeyChecking":            {"yes", "no", "ask", "accept-new", "off", true, false},
+	"TCPKeepAlive":                     yesNo,
+	"Tunnel":                           {"yes", "no", "point-to-point", "ethernet", true, false},
+	"UpdateHostKeys":                   {"yes", "no", "ask", true, false},
+	"UsePrivilegedPort":                yesNo,
+	"VerifyHostKeyDNS":                 {"yes", "no", "ask", true, false},
+	"VisualHostKey":                    yesNo,
+}
+
+// schemaScalarTypes are the JSON types of the string options whose values
+// are usually written as YAML numbers or booleans, they are decoded with
+// their original text (i.e: `StreamLocalBindMask: 0177`)
+var schemaScalarTypes = map[string][]string{
+	"CanonicalizeMaxDots":     {"string", "integer"},
+	"ConnectionAttempts":      {"string", "integer"},
+	"ControlPersist":          {"string", "integer", "boolean"},
+	"ForwardAgent":            {"string", "boolean"},
+	"NumberOfPasswordPrompts": {"string", "integer"},
+	"Port":                    {"string", "integer"},
+	"RekeyLimit":              {"string", "integer"},
+	"StreamLocalBindMask":     {"string", "integer"},
+}
+
+// schemaDescriptions documents the fields, keyed by "Type.Field"
+var schemaDescriptions = map[string]string{
+	"Config.Hosts":             "Hosts, keyed by name or pattern",
+	"Config.Templates":         "Templates, inherited by hosts but never written to ~/.ssh/config",
+	"Config.Defaults":          "Options applied to every host",
+	"Config.Includes":          "Other configuration files (glob patterns) or inventory providers",
+	"Config.Profiles":          "Alternative defaults, templates and hosts selected with --profile",
+	"Config.Vars":              "Variables available in the templated values with {{.Vars.name}}",
+	"Config.Matches":           "OpenSSH Match blocks",
+	"Config.ASSHKnownHostFile": "Path of the file listing the hosts known by assh",
+	"Config.ASSHBinaryPath":    "Path of the assh binary used in the generated ProxyCommand",
+	"Config.SSHConfigDir":      "Directory where the generated configuration is written as Include-able files",
+	"Config.EncryptionKey":     "Path of the X25519 private key decrypting the encrypted includes (default: ~/.ssh/assh.key)",
+	"Config.TrustedKeys":       "Base64-encoded ed25519 public keys, the files loaded after must be signed by one of them",
+	"Config.UntrustedIncludes": "Skip the unsigned or modified includes (refuse) or load them without their options running commands (strip)",
+
+	"Host.AddressFamily":                    "Address family to use when connecting",
+	"Host.AskPassGUI":                       "Use a graphical passphrase prompt (macOS)",
+	"Host.BatchMode":                        "Disable the user interaction such as password prompts",
+	"Host.BindAddress":                      "Local address used as the source address of the connection",
+	"Host.CanonicalDomains":                 "Domain suffixes searched when canonicalizing the host name",
+	"Host.CanonicalizeFallbackLocal":        "Fall back to the system resolver when the canonicalization fails",
+	"Host.CanonicalizeHostname":             "Rewrite the host name to its canonical form",
+	"Host.CanonicalizeMaxDots":              "Maximum number of dots in a host name before the canonicalization is disabled",
+	"Host.CanonicalizePermittedCNAMEs":      "Rules following the CNAMEs during the canonicalization",
+	"Host.ChallengeResponseAuthentication":  "Use the challenge-response authentication",
+	"Host.CheckHostIP":                      "Also check the host IP address in the known_hosts file",
+	"Host.Cipher":                           "Cipher of the protocol version 1",
+	"Host.Ciphers":                          "Allowed ciphers, in order of preference",
+	"Host.ClearAllForwardings":              "Clear the local, remote and dynamic port forwardings",
+	"Host.Compression":                      "Compress the connection",
+	"Host.CompressionLevel":                 "Compression level of the protocol version 1, from 1 to 9",
+	"Host.ConnectionAttempts":               "Number of connection attempts before exiting",
+	"Host.ConnectTimeout":                   "Timeout in seconds of the connection",
+	"Host.ControlMaster":                    "Share the connections over a single network connection",
+	"Host.ControlPath":                      "Path of the control socket of the shared connections",
+	"Host.ControlPersist":                   "Keep the master connection open in the background",
+	"Host.DynamicForward":                   "Local ports forwarded over the connection as SOCKS proxies",
+	"Host.EnableSSHKeysign":                 "Enable ssh-keysign for the host-based authentication",
+	"Host.EscapeChar":                       "Escape character of the session",
+	"Host.ExitOnForwardFailure":             "Exit if a port forwarding cannot be set up",
+	"Host.FingerprintHash":                  "Hash algorithm of the displayed key fingerprints",
+	"Host.ForwardAgent":                     "Forward the authentication agent, or the path of an agent socket",
+	"Host.ForwardX11":                       "Forward the X11 connections",
+	"Host.ForwardX11Timeout":                "Timeout of the untrusted X11 forwarding",
+	"Host.ForwardX11Trusted":                "Give full access to the X11 display to the remote clients",
+	"Host.GatewayPorts":                     "Allow remote hosts to connect to the local forwarded ports",
+	"Host.GlobalKnownHostsFile":             "Global known hosts files",
+	"Host.GSSAPIAuthentication":             "Use the GSSAPI authentication",
+	"Host.GSSAPIClientIdentity":             "GSSAPI client identity",
+	"Host.GSSAPIDelegateCredentials":        "Forward the GSSAPI credentials",
+	"Host.GSSAPIKeyExchange":                "Use the GSSAPI key exchange",
+	"Host.GSSAPIRenewalForcesRekey":         "Rekey when the GSSAPI credentials are renewed",
+	"Host.GSSAPIServerIdentity":             "Expected GSSAPI server identity",
+	"Host.GSSAPITrustDns":                   "Trust the DNS to canonicalize the GSSAPI server name",
+	"Host.HashKnownHosts":                   "Hash the names added to the known_hosts file",
+	"Host.HostbasedAuthentication":          "Use the host-based authentication",
+	"Host.HostbasedKeyTypes":                "Key types used for the host-based authentication",
+	"Host.HostKeyAlgorithms":                "Accepted host key algorithms, in order of preference",
+	"Host.HostKeyAlias":                     "Name used instead of the host name in the known_hosts file",
+	"Host.IdentitiesOnly":                   "Only use the configured identity files",
+	"Host.IdentityFile":                     "Private keys used for the authentication",
+	"Host.IgnoreUnknown":                    "Patterns of unknown options to ignore",
+	"Host.IPQoS":                            "IP type-of-service of the interactive and non-interactive sessions",
+	"Host.KbdInteractiveAuthentication":     "Use the keyboard-interactive authentication",
+	"Host.KbdInteractiveDevices":            "Methods of the keyboard-interactive authentication",
+	"Host.KexAlgorithms":                    "Allowed key exchange algorithms, in order of preference",
+	"Host.KeychainIntegration":              "Store the passphrases in the keychain (macOS)",
+	"Host.LocalCommand":                     "Command run locally after connecting, requires PermitLocalCommand",
+	"Host.LocalForward":                     "Local ports forwarded to remote addresses",
+	"Host.LogLevel":                         "Verbosity of the ssh messages",
+	"Host.MACs":                             "Allowed MAC algorithms, in order of preference",
+	"Host.Match":                            "Match criteria of the host",
+	"Host.NoHostAuthenticationForLocalhost": "Skip the host key check for localhost",
+	"Host.NumberOfPasswordPrompts":          "Number of password prompts before giving up",
+	"Host.PasswordAuthentication":           "Use the password authentication",
+	"Host.PermitLocalCommand":               "Allow the LocalCommand option and the !command escape",
+	"Host.PKCS11Provider":                   "PKCS#11 provider used for the authentication",
+	"Host.Port":                             "Port of the remote host",
+	"Host.PreferredAuthentications":         "Authentication methods, in order of preference",
+	"Host.Protocol":                         "Protocol versions, in order of preference",
+	"Host.ProxyUseFdpass":                   "The ProxyCommand passes a connected file descriptor back to ssh",
+	"Host.PubkeyAcceptedKeyTypes":           "Key types used for the public key authentication",
+	"Host.PubkeyAuthentication":             "Use the public key authentication",
+	"Host.RekeyLimit":                       "Amount of data and time before renegotiating the session key",
+	"Host.RemoteForward":                    "Remote ports forwarded to local addresses",
+	"Host.RequestTTY":                       "Request a pseudo-tty for the session",
+	"Host.RevokedHostKeys":                  "File of the revoked host keys",
+	"Host.RhostsRSAAuthentication":          "Use the rhosts based RSA authentication",
+	"Host.RSAAuthentication":                "Use the RSA authentication of the protocol version 1",
+	"Host.SendEnv":                          "Local environment variables sent to the server",
+	"Host.ServerAliveCountMax":              "Number of unanswered keepalive messages before disconnecting",
+	"Host.ServerAliveInterval":              "Seconds of inactivity before sending a keepalive message",
+	"Host.StreamLocalBindMask":              "Octal file creation mask of the forwarded Unix-domain sockets",
+	"Host.StreamLocalBindUnlink":            "Remove an existing Unix-domain socket before forwarding to it",
+	"Host.StrictHostKeyChecking":            "Refuse unknown or changed host keys",
+	"Host.TCPKeepAlive":                     "Send TCP keepalive messages",
+	"Host.Tunnel":                           "Forward a tun device",
+	"Host.TunnelDevice":                     "Local and remote tun devices, as local:remote",
+	"Host.UpdateHostKeys":                   "Accept the additional host keys sent by the server",
+	"Host.UsePrivilegedPort":                "Use a privileged source port",
+	"Host.User":                             "Remote user name",
+	"Host.UserKnownHostsFile":               "User known hosts files",
+	"Host.VerifyHostKeyDNS":                 "Verify the host key with the SSHFP DNS records",
+	"Host.VisualHostKey":                    "Display an ASCII art of the host key fingerprint",
+	"Host.XAuthLocation":                    "Path of the xauth program",
+	"Host.HostName":                         "Real host name or IP address, supports the OpenSSH tokens",
+	"Host.ProxyCommand":                     "Command used to connect, the default ProxyCommand of assh handles the gateways",
+	"Host.Inherits":                         "Hosts or templates whose options are inherited",
+	"Host.Gateways":                         "Hosts used to reach the host, in order of preference, `direct` connects without gateway",
+	"Host.Locations":                        "Network locations replacing the gateways, the first matching location wins",
+	"Host.ResolveNameservers":               "Nameservers used to resolve the host name",
+	"Host.ResolveCommand":                   "Command printing the host name to connect to",
+	"Host.ControlMasterMkdir":               "Create the directory of the ControlPath",
+	"Host.Aliases":                          "Other names of the host",
+	"Host.Hooks":                            "Hooks called at the different steps of the connection",
+	"Host.Vars":                             "Variables of the host, available in the templated values with {{.Vars.name}}",
+
+	"HostHooks.BeforeConnect":  "Hooks called before connecting",
+	"HostHooks.OnConnect":      "Hooks called once connected",
+	"HostHooks.OnDisconnect":   "Hooks called after disconnecting",
+	"HostHooks.OnConnectError": "Hooks called when the connection fails",
+
+	"Location.Name":     "Name of the location",
+	"Location.CIDR":     "Matches if a local interface has an address in one of the networks",
+	"Location.Route":    "Matches if the default route goes through one of the addresses",
+	"Location.Probe":    "Matches if a TCP connection to the host:port address succeeds",
+	"Location.Env":      "Matches if the NAME environment variable is set, or equals value for NAME=value",
+	"Location.Gateways": "Gateways of the host when the location matches",
+
+	"MatchBlock.Canonical":    "Matches when the hostname canonicalization is enabled",
+	"MatchBlock.Final":        "Matches during the final pass of the configuration parsing",
+	"MatchBlock.All":          "Always matches",
+	"MatchBlock.Host":         "Patterns of the target host name",
+	"MatchBlock.OriginalHost": "Patterns of the host name as typed on the command line",
+	"MatchBlock.User":         "Patterns of the remote user",
+	"MatchBlock.LocalUser":    "Patterns of the local user",
+	"MatchBlock.Exec":         "Matches if the command exits successfully",
+	"MatchBlock.Position":     "Position of the block relative to the Host blocks",
+	"MatchBlock.Options":      "Options applied when the criteria match",
+
+	"Profile.Defaults":  "Options applied to every host",
+	"Profile.Templates": "Templates of the profile",
+	"Profile.Hosts":     "Hosts of the profile",
+}
+
+var (
+	stringorsliceType = reflect.TypeOf(composeyaml.Stringorslice{})
+	hooksType         = reflect.TypeOf(hooks.Hooks{})
+	includeType       = reflect.TypeOf(Include{})
+)
+
+type schemaGenerator struct {
+	definitions map[string]interface{}
+}
+
+// JSONSchema returns a JSON Schema (draft-07) of the assh.yml files,
+// generated from the Config and Host structs. The keys are case-insensitive
+// so the property names are validated with a pattern, the documented
+// names are listed as properties for the completion
+func JSONSchema() map[string]interface{} {
+	g := schemaGenerator{definitions: map[string]interface{}{
+		"stringOrSlice": map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+		},
+	}}
+
+	schema := g.objectSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "assh.yml"
+	schema["definitions"] = g.definitions
+	return schema
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case stringorsliceType, hooksType:
+		return map[string]interface{}{"$ref": "#/definitions/stringOrSlice"}
+	case includeType:
+		// an include is a file pattern or the parameters of a provider
+		return map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{
+					"type":     "object",
+					"required": []string{"provider"},
+					"properties": map[string]interface{}{
+						"provider": map[string]interface{}{"type": "string", "enum": providerNames()},
+					},
+				},
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		// i.e: a host declared without options
+		return map[string]interface{}{"anyOf": []interface{}{g.typeSchema(t.Elem()), map[string]interface{}{"type": "null"}}}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.String {
+			// i.e: the variables, any scalar is decoded as a string
+			return map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": []string{"string", "number", "boolean"}}}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		name := string(unicode.ToLower(rune(t.Name()[0]))) + t.Name()[1:]
+		if _, found := g.definitions[name]; !found {
+			// registered before walking the fields, a struct may reference itself
+			g.definitions[name] = nil
+			g.definitions[name] = g.objectSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + name}
+	default:
+		panic(fmt.Errorf("no JSON Schema for the %s type", t))
+	}
+}
+
+// objectSchema returns the schema of the yaml fields of a struct
+func (g *schemaGenerator) objectSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	keys := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.PkgPath != "" || tag == "" || tag == "-" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.typeSchema(field.Type)
+		if types, found := schemaScalarTypes[field.Name]; found {
+			property["type"] = types
+		}
+		if enum, found := schemaEnums[field.Name]; found {
+			property["enum"] = enum
+			delete(property, "type")
+		}
+		if description, found := schemaDescriptions[t.Name()+"."+field.Name]; found {
+			if _, isRef := property["$ref"]; isRef {
+				// the siblings of a $ref are ignored
+				property = map[string]interface{}{"allOf": []interface{}{property}}
+			}
+			property["description"] = description
+		}
+		properties[name] = property
+		keys = append(keys, tag)
+	}
+
+	return map[string]interface{}{
+		"type":          "object",
+		"properties":    properties,
+		"propertyNames": map[string]interface{}{"pattern": caseInsensitivePattern(keys)},
+	}
+}
+
+// caseInsensitivePattern returns a regular expression matching the keys in
+// any case, the JSON Schema patterns have no case-insensitive flag
+func caseInsensitivePattern(keys []string) string {
+	sort.Strings(keys)
+	alternatives := []string{}
+	for _, key := range keys {
+		var pattern string
+		for _, char := range strings.ToLower(key) {
+			if upper := unicode.ToUpper(char); upper != char {
+				pattern += fmt.Sprintf("[%c%c]", char, upper)
+			} else {
+				pattern += regexp.QuoteMeta(string(char))
+			}
+		}
+		alternatives = append(alternatives, pattern)
+	}
+	return fmt.Sprintf("^(%s)$", strings.Join(alternatives, "|"))
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v2"
+)
+
+func TestJSONSchema(t *testing.T) {
+	Convey("Testing JSONSchema()", t, FailureContinues, func() {
+		schema := JSONSchema()
+		_, err := json.Marshal(schema)
+		So(err, ShouldBeNil)
+
+		definitions := schema["definitions"].(map[string]interface{})
+		host := definitions["host"].(map[string]interface{})
+		properties := host["properties"].(map[string]interface{})
+
+		Convey("every host option is documented", func() {
+			hostType := reflect.TypeOf(Host{})
+			for i := 0; i < hostType.NumField(); i++ {
+				if hostType.Field(i).PkgPath != "" {
+					continue
+				}
+				So(schemaDescriptions["Host."+hostType.Field(i).Name], ShouldNotBeEmpty)
+			}
+			So(len(properties), ShouldEqual, len(hostKeys))
+		})
+
+		Convey("option types", func() {
+			So(properties["User"], ShouldResemble, map[string]interface{}{
+				"type":        "string",
+				"description": "Remote user name",
+			})
+			So(properties["ConnectTimeout"].(map[string]interface{})["type"], ShouldEqual, "integer")
+			So(properties["Port"].(map[string]interface{})["type"], ShouldResemble, []string{"string", "integer"})
+			So(properties["Compression"].(map[string]interface{})["enum"], ShouldResemble, []interface{}{"yes", "no", true, false})
+			So(properties["Gateways"].(map[string]interface{})["allOf"], ShouldResemble, []interface{}{
+				map[string]interface{}{"$ref": "#/definitions/stringOrSlice"},
+			})
+			So(definitions["stringOrSlice"], ShouldNotBeNil)
+			So(definitions["hostHooks"], ShouldNotBeNil)
+			So(definitions["location"], ShouldNotBeNil)
+			So(definitions["matchBlock"], ShouldNotBeNil)
+			So(definitions["profile"], ShouldNotBeNil)
+		})
+
+		Convey("validation", func() {
+			validate := func(document string) []string {
+				var value interface{}
+				So(yaml.Unmarshal([]byte(document), &value), ShouldBeNil)
+				return validateSchema(schema, schema, toJSONValue(value), "")
+			}
+
+			readme, err := ioutil.ReadFile("../../README.md")
+			So(err, ShouldBeNil)
+			example := strings.SplitN(string(readme), "`~/.ssh/assh.yml` is a [YAML]", 2)[1]
+			example = strings.SplitN(strings.SplitN(example, "```yaml\n", 2)[1], "```", 2)[0]
+			So(validate(example), ShouldBeEmpty)
+
+			So(validate(`hosts:
+  aaa:
+    Port: 22
+    ConnectTimeout: 10
+    StreamLocalBindMask: 0177
+    ControlPersist: yes
+    Compression: yes
+vars:
+  port: 2222
+`), ShouldBeEmpty)
+			So(validate(`hosts:
+  aaa:
+    Port: [22]
+    ConnectTimeout: ten
+    Compression: maybe
+    Gatways: bastion
+`), ShouldResemble, []string{
+				`/hosts/aaa/Compression: "maybe" is not in the enum`,
+				`/hosts/aaa/ConnectTimeout: "ten" is not of type integer`,
+				`/hosts/aaa: invalid property name "Gatways"`,
+				`/hosts/aaa/Port: [22] is not of type string, integer`,
+			})
+		})
+
+		Convey("property names are case-insensitive", func() {
+			pattern := regexp.MustCompile(host["propertyNames"].(map[string]interface{})["pattern"].(string))
+			So(pattern.MatchString("HostName"), ShouldBeTrue)
+			So(pattern.MatchString("hostname"), ShouldBeTrue)
+			So(pattern.MatchString("Hostname"), ShouldBeTrue)
+			So(pattern.MatchString("Gatways"), ShouldBeFalse)
+			So(pattern.MatchString("HostNameX"), ShouldBeFalse)
+
+			root := regexp.MustCompile(schema["propertyNames"].(map[string]interface{})["pattern"].(string))
+			So(root.MatchString("ASSHBinaryPath"), ShouldBeTrue)
+			So(root.MatchString("hosts"), ShouldBeTrue)
+			So(root.MatchString("origins"), ShouldBeFalse)
+		})
+	})
+}
+
+// validateSchema returns the errors of a JSON value against the subset of
+// JSON Schema used by JSONSchema
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, found := schema["$ref"].(string); found {
+		definition := root["definitions"].(map[string]interface{})[strings.TrimPrefix(ref, "#/definitions/")]
+		return validateSchema(root, definition.(map[string]interface{}), value, path)
+	}
+
+	errors := []string{}
+	if allOf, found := schema["allOf"].([]interface{}); found {
+		for _, sub := range allOf {
+			errors = append(errors, validateSchema(root, sub.(map[string]interface{}), value, path)...)
+		}
+	}
+	if anyOf, found := schema["anyOf"].([]interface{}); found {
+		matched := false
+		for _, sub := range anyOf {
+			if len(validateSchema(root, sub.(map[string]interface{}), value, path)) == 0 {
+				matched = true
+			}
+		}
+		if !matched {
+			// report the errors of the alternative of the same type
+			for _, sub := range anyOf {
+				sub := sub.(map[string]interface{})
+				for ref, found := sub["$ref"].(string); found; ref, found = sub["$ref"].(string) {
+					sub = root["definitions"].(map[string]interface{})[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+				}
+				if sub["type"] == jsonTypeOf(value) {
+					errors = append(errors, validateSchema(root, sub, value, path)...)
+					break
+				}
+			}
+		}
+	}
+	if enum, found := schema["enum"].([]interface{}); found {
+		matched := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				matched = true
+			}
+		}
+		if !matched {
+			errors = append(errors, fmt.Sprintf("%s: %q is not in the enum", path, value))
+		}
+	}
+	if schemaType, found := schema["type"]; found {
+		types := []string{}
+		switch schemaType := schemaType.(type) {
+		case string:
+			types = append(types, schemaType)
+		case []string:
+			types = schemaType
+		}
+		matched := false
+		for _, name := range types {
+			if jsonTypeOf(value) == name || (name == "number" && jsonTypeOf(value) == "integer") {
+				matched = true
+			}
+		}
+		if !matched {
+			output, _ := json.Marshal(value)
+			return append(errors, fmt.Sprintf("%s: %s is not of type %s", path, output, strings.Join(types, ", ")))
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, key := range keys {
+			if propertyNames, found := schema["propertyNames"].(map[string]interface{}); found {
+				if !regexp.MustCompile(propertyNames["pattern"].(string)).MatchString(key) {
+					errors = append(errors, fmt.Sprintf("%s: invalid property name %q", path, key))
+					continue
+				}
+			}
+			sub, found := properties[key].(map[string]interface{})
+			if !found {
+				sub, _ = schema["additionalProperties"].(map[string]interface{})
+			}
+			if sub != nil {
+				errors = append(errors, validateSchema(root, sub, value[key], path+"/"+key)...)
+			}
+		}
+	case []interface{}:
+		if items, found := schema["items"].(map[string]interface{}); found {
+			for idx, entry := range value {
+				errors = append(errors, validateSchema(root, items, entry, fmt.Sprintf("%s/%d", path, idx))...)
+			}
+		}
+	}
+	return errors
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// toJSONValue converts a generic YAML value into a generic JSON value
+func toJSONValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := map[string]interface{}{}
+		for key, entry := range value {
+			object[fmt.Sprintf("%v", key)] = toJSONValue(entry)
+		}
+		return object
+	case []interface{}:
+		array := []interface{}{}
+		for _, entry := range value {
+			array = append(array, toJSONValue(entry))
+		}
+		return array
+	case int:
+		return float64(value)
+	case float64, bool, string, nil:
+		return value
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/flexyaml"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// Policies of the includes without a valid signature from a trusted key
+const (
+	UntrustedIncludesRefuse = "refuse"
+	UntrustedIncludesStrip  = "strip"
+)
+
+// signatureBlockType is the PEM type of the detached signatures, the Key
+// header is the public key of the signer
+const signatureBlockType = "ASSH SIGNATURE"
+
+// DefaultSigningKey is the ed25519 private key used by `assh config sign`
+const DefaultSigningKey = "~/.ssh/assh-signing.key"
+
+// executableHostKeys are the host options running commands on the local host
+// or that are rendered into them (Vars), they are ignored in the untrusted includes
+var executableHostKeys = map[string]bool{
+	"proxycommand":       true,
+	"resolvecommand":     true,
+	"localcommand":       true,
+	"permitlocalcommand": true,
+	"pkcs11provider":     true,
+	"xauthlocation":      true,
+	"match":              true,
+	"hooks":              true,
+	"vars":               true,
+}
+
+// SignatureFile returns the path of the detached signature of a file
+func SignatureFile(path string) string {
+	return path + ".sig"
+}
+
+// Sign returns the detached signature of content
+func Sign(content []byte, privateKey ed25519.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    signatureBlockType,
+		Headers: map[string]string{"Key": base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey))},
+		Bytes:   ed25519.Sign(privateKey, content),
+	})
+}
+
+// VerifySignature checks the detached signature of content was made by one
+// of the trusted keys
+func VerifySignature(content, signature []byte, trustedKeys []string) error {
+	block, _ := pem.Decode(bytes.TrimSpace(signature))
+	if block == nil || block.Type != signatureBlockType {
+		return fmt.Errorf("invalid signature file")
+	}
+
+	signer := block.Headers["Key"]
+	trusted := false
+	for _, key := range trustedKeys {
+		if strings.TrimSpace(key) == signer {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("signed by the untrusted key %s", signer)
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(signer)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid signer key %q", signer)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), content, block.Bytes) {
+		return fmt.Errorf("the signature does not match the content, the file was modified after being signed")
+	}
+	return nil
+}
+
+// GenerateSigningKeyFile writes a new ed25519 private key to path and returns its public key
+func GenerateSigningKeyFile(path string) (ed25519.PublicKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := utils.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(privateKey)
+	return publicKey, ioutil.WriteFile(expanded, []byte(encoded+"\n"), 0600)
+}
+
+// LoadSigningKey reads an ed25519 private key written by GenerateSigningKeyFile
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	expanded, err := utils.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(raw) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s: invalid key, expected %d base64-encoded bytes", path, ed25519.PrivateKeySize)
+	}
+	return ed25519.PrivateKey(raw), nil
+}
+
+// verifyInclude checks the signature of a file loaded once trusted keys are
+// configured, it returns the reason why the file is not trusted
+func (c *Config) verifyInclude(path string, content []byte) error {
+	c.stamps[SignatureFile(path)] = stampFile(SignatureFile(path))
+	signature, err := ioutil.ReadFile(SignatureFile(path))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no signature (%s)", SignatureFile(path))
+	}
+	if err != nil {
+		return err
+	}
+	return VerifySignature(content, signature, c.TrustedKeys)
+}
+
+func (c *Config) untrustedIncludesPolicy() string {
+	if strings.ToLower(c.UntrustedIncludes) == UntrustedIncludesStrip {
+		return UntrustedIncludesStrip
+	}
+	return UntrustedIncludesRefuse
+}
+
+// stripExecutable removes the options running commands from an untrusted
+// document: the executable host options (in hosts, templates, defaults,
+// profiles and matches), the exec match criteria, the inventory providers
+// (their mapping may set any host option), the global variables, the assh
+// binary path and the trust settings
+func stripExecutable(buf []byte) ([]byte, []string, error) {
+	return flexyaml.Filter(buf, &Config{}, func(path []string, value interface{}) bool {
+		switch {
+		case len(path) == 1:
+			switch path[0] {
+			case "asshbinarypath", "trustedkeys", "untrustedincludes", "vars":
+				return true
+			}
+		case len(path) == 2 && path[0] == "includes":
+			// the file patterns are kept, the matching files are verified too
+			_, isProvider := value.(yaml.MapSlice)
+			return isProvider
+		case len(path) == 3 && path[0] == "matches" && path[2] == "exec":
+			return true
+		}
+		key, isHostOption := hostOptionKey(path)
+		return isHostOption && executableHostKeys[key]
+	})
+}
+
+// hostOptionKey returns the option of a path designating a host option, i.e:
+// ["hosts", "foo", "proxycommand"] or ["profiles", "travel", "defaults", "user"]
+func hostOptionKey(path []string) (string, bool) {
+	if len(path) > 2 && path[0] == "profiles" {
+		path = path[2:]
+	}
+	switch {
+	case len(path) == 2 && path[0] == "defaults":
+	case len(path) == 3 && (path[0] == "hosts" || path[0] == "templates"):
+	case len(path) == 4 && path[0] == "matches" && path[2] == "options":
+	default:
+		return "", false
+	}
+	return path[len(path)-1], true
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSignature(t *testing.T) {
+	Convey("Testing the signatures of the configuration files", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		keyFile := filepath.Join(dir, "signing.key")
+		publicKey, err := GenerateSigningKeyFile(keyFile)
+		So(err, ShouldBeNil)
+		privateKey, err := LoadSigningKey(keyFile)
+		So(err, ShouldBeNil)
+		So(privateKey.Public(), ShouldResemble, publicKey)
+		info, err := os.Stat(keyFile)
+		So(err, ShouldBeNil)
+		So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+		trusted := []string{base64.StdEncoding.EncodeToString(publicKey)}
+		content := []byte("hosts:\n  jump:\n    ProxyCommand: nc %h %p\n")
+		signature := Sign(content, privateKey)
+		So(string(signature), ShouldContainSubstring, "Key: "+trusted[0])
+
+		So(VerifySignature(content, signature, trusted), ShouldBeNil)
+
+		err = VerifySignature(append(content, " "...), signature, trusted)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "modified")
+
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		err = VerifySignature(content, Sign(content, otherKey), trusted)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "untrusted key")
+
+		So(VerifySignature(content, []byte("garbage"), trusted), ShouldNotBeNil)
+		So(SignatureFile("/etc/assh.yml"), ShouldEqual, "/etc/assh.yml.sig")
+	})
+}
+
+func TestStripExecutable(t *testing.T) {
+	Convey("Testing stripExecutable()", t, FailureContinues, func() {
+		stripped, removed, err := stripExecutable([]byte(`hosts:
+  jump:
+    User: admin
+    ProxyCommand: nc %h %p
+    Hooks:
+      OnConnect:
+      - exec touch /tmp/pwned
+templates:
+  base:
+    LocalCommand: id
+    PermitLocalCommand: yes
+defaults:
+  ResolveCommand: /bin/resolve
+  Compression: yes
+includes:
+- provider: exec
+  command: ./inventory.sh
+- provider: terraform
+  path: terraform.tfstate
+  mapping:
+    aws_instance:
+      host:
+        ProxyCommand: nc %h %p
+- ~/.ssh/assh.d/*.yml
+matches:
+- exec: "true"
+  host: "*.corp"
+  options:
+    ProxyCommand: nc %h %p
+    User: corp
+profiles:
+  travel:
+    defaults:
+      ProxyCommand: nc -X 5 %h %p
+vars:
+  token: secret
+ASSHBinaryPath: /tmp/evil
+TrustedKeys: [foo]
+`))
+		So(err, ShouldBeNil)
+		So(removed, ShouldResemble, []string{
+			"hosts/jump/ProxyCommand",
+			"hosts/jump/Hooks",
+			"templates/base/LocalCommand",
+			"templates/base/PermitLocalCommand",
+			"defaults/ResolveCommand",
+			"includes/0",
+			"includes/1",
+			"matches/0/exec",
+			"matches/0/options/ProxyCommand",
+			"profiles/travel/defaults/ProxyCommand",
+			"vars",
+			"ASSHBinaryPath",
+			"TrustedKeys",
+		})
+
+		config := New()
+		So(config.LoadConfig(bytes.NewReader(stripped)), ShouldBeNil)
+		So(config.Hosts["jump"].User, ShouldEqual, "admin")
+		So(config.Hosts["jump"].ProxyCommand, ShouldEqual, "")
+		So(config.Hosts["jump"].Hooks, ShouldBeNil)
+		So(config.Defaults.Compression, ShouldEqual, "yes")
+		So(len(config.Includes), ShouldEqual, 1)
+		So(config.Matches[0].Exec, ShouldEqual, "")
+		So(config.Matches[0].Options.User, ShouldEqual, "corp")
+		So(config.Profiles["travel"].Defaults.ProxyCommand, ShouldEqual, "")
+		So(config.ASSHBinaryPath, ShouldEqual, "")
+		So(len(config.TrustedKeys), ShouldEqual, 0)
+	})
+}
+
+func TestConfig_LoadFile_signed(t *testing.T) {
+	Convey("Testing Config.LoadFile() with trusted keys", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+
+		files := map[string]string{
+			"signed.yml":   "hosts:\n  signed:\n    ProxyCommand: nc %h %p\n",
+			"tampered.yml": "hosts:\n  tampered:\n    User: team\n    ProxyCommand: nc %h %p\n",
+			"unsigned.yml": "hosts:\n  unsigned:\n    User: team\n    ResolveCommand: /bin/resolve\n",
+			"other.yml":    "hosts:\n  other:\n    User: other\n",
+		}
+		for name, content := range files {
+			path := filepath.Join(dir, "assh.d", name)
+			So(os.MkdirAll(filepath.Dir(path), 0700), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+			switch name {
+			case "signed.yml":
+				So(ioutil.WriteFile(SignatureFile(path), Sign([]byte(content), privateKey), 0644), ShouldBeNil)
+			case "tampered.yml":
+				So(ioutil.WriteFile(SignatureFile(path), Sign([]byte("hosts: {}\n"), privateKey), 0644), ShouldBeNil)
+			case "other.yml":
+				So(ioutil.WriteFile(SignatureFile(path), Sign([]byte(content), otherKey), 0644), ShouldBeNil)
+			}
+		}
+
+		main := func(policy string) string {
+			path := filepath.Join(dir, "assh.yml")
+			content := fmt.Sprintf("TrustedKeys: %s\nUntrustedIncludes: %s\nincludes:\n- %s\n", base64.StdEncoding.EncodeToString(publicKey), policy, filepath.Join(dir, "assh.d", "*.yml"))
+			So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+			return path
+		}
+
+		Convey("refusing the untrusted includes", func() {
+			config := New()
+			So(config.LoadFile(main("refuse")), ShouldBeNil)
+			So(config.sortedNames(), ShouldResemble, []string{"signed"})
+			So(config.Hosts["signed"].ProxyCommand, ShouldEqual, "nc %h %p")
+
+			diagnostics := config.Validate()
+			So(len(diagnostics), ShouldEqual, 3)
+			for _, diagnostic := range diagnostics {
+				So(diagnostic.Severity, ShouldEqual, SeverityError)
+				So(diagnostic.Message, ShouldStartWith, "untrusted include refused")
+			}
+		})
+
+		Convey("stripping the untrusted includes", func() {
+			config := New()
+			So(config.LoadFile(main("strip")), ShouldBeNil)
+			So(config.sortedNames(), ShouldResemble, []string{"other", "signed", "tampered", "unsigned"})
+			So(config.Hosts["signed"].ProxyCommand, ShouldEqual, "nc %h %p")
+			So(config.Hosts["tampered"].User, ShouldEqual, "team")
+			So(config.Hosts["tampered"].ProxyCommand, ShouldEqual, "")
+			So(config.Hosts["unsigned"].User, ShouldEqual, "team")
+			So(config.Hosts["unsigned"].ResolveCommand, ShouldEqual, "")
+
+			diagnostics := config.Validate()
+			So(len(diagnostics), ShouldEqual, 3)
+			for _, diagnostic := range diagnostics {
+				So(diagnostic.Severity, ShouldEqual, SeverityWarning)
+			}
+		})
+
+		Convey("without trusted keys", func() {
+			config := New()
+			So(config.LoadFiles(filepath.Join(dir, "assh.d", "*.yml")), ShouldBeNil)
+			So(len(config.Hosts), ShouldEqual, 4)
+			So(config.Hosts["tampered"].ProxyCommand, ShouldEqual, "nc %h %p")
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+	"github.com/noqqe/advanced-ssh-config/pkg/version"
+)
+
+var unsafeFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SSHConfigFiles returns the files written in SSHConfigDir by file name, the
+// hosts are grouped by the file declaring them; OpenSSH includes the files
+// in lexical order: the match blocks placed before the hosts, the hosts, the
+// match blocks placed after the hosts and the global configuration
+func (c *Config) SSHConfigFiles() (map[string][]byte, error) {
+	files := make(map[string]*bytes.Buffer)
+	fileFor := func(name, source string) *bytes.Buffer {
+		if _, found := files[name]; !found {
+			files[name] = &bytes.Buffer{}
+			fmt.Fprintf(files[name], "%s v%s, based on %s\n", generatedHeader, version.VERSION, source)
+			if c.activeProfile != "" {
+				fmt.Fprintf(files[name], "# profile: %s\n", c.activeProfile)
+			}
+			fmt.Fprintln(files[name])
+		}
+		return files[name]
+	}
+
+	if c.hasMatchBlocks(MatchPositionBefore) {
+		if err := c.writeMatchBlocks(fileFor("00-matches.conf", "matches"), MatchPositionBefore); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range c.sortedNames() {
+		source := "assh.yml"
+		if origin, found := c.OriginOf("hosts", name); found {
+			source = origin.File
+		}
+		if err := c.writeHostTo(fileFor(sshConfigFileName(source), source), name); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.hasMatchBlocks(MatchPositionAfter) {
+		if err := c.writeMatchBlocks(fileFor("80-matches.conf", "matches"), MatchPositionAfter); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.writeDefaultsTo(fileFor("90-defaults.conf", "defaults")); err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string][]byte, len(files))
+	for name, buffer := range files {
+		contents[name] = buffer.Bytes()
+	}
+	return contents, nil
+}
+
+// sshConfigFileName returns the name of the file containing the hosts declared in source
+func sshConfigFileName(source string) string {
+	name := source
+	// inventory providers are named "provider:params"
+	if !strings.Contains(source, ":") {
+		name = strings.TrimSuffix(path.Base(source), path.Ext(source))
+	}
+	return fmt.Sprintf("10-%s.conf", strings.Trim(unsafeFileNameRegex.ReplaceAllString(name, "_"), "_"))
+}
+
+// saveSSHConfigDir writes the files of SSHConfigDir, only the changed files
+// are written and the files of removed sources are deleted. It returns the
+// expanded path of the directory.
+func (c *Config) saveSSHConfigDir() (string, error) {
+	dir, err := utils.ExpandUser(c.SSHConfigDir)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	files, err := c.SSHConfigFiles()
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		if existing, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(existing, files[name]) {
+			continue
+		}
+		Logger.Debugf("Writing SSH config file to %q", filename)
+		if err = utils.WriteFileAtomic(filename, files[name], 0644); err != nil {
+			return "", err
+		}
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return "", err
+	}
+	for _, filename := range stale {
+		if _, found := files[filepath.Base(filename)]; found {
+			continue
+		}
+		// the files without the assh header are never removed
+		content, err := ioutil.ReadFile(filename)
+		if err != nil || !bytes.HasPrefix(content, []byte(generatedHeader)) {
+			continue
+		}
+		Logger.Debugf("Removing stale SSH config file %q", filename)
+		if err = os.Remove(filename); err != nil {
+			return "", err
+		}
+	}
+
+	// the modification date of the directory is compared with the assh
+	// configuration files to detect an outdated build
+	now := time.Now()
+	return dir, os.Chtimes(dir, now, now)
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSSHConfigFileName(t *testing.T) {
+	Convey("Testing sshConfigFileName()", t, func() {
+		So(sshConfigFileName("/home/bob/.ssh/assh.yml"), ShouldEqual, "10-assh.conf")
+		So(sshConfigFileName("/home/bob/.ssh/assh.d/web servers.yml"), ShouldEqual, "10-web_servers.conf")
+		So(sshConfigFileName("ansible:inventory/production.ini"), ShouldEqual, "10-ansible_inventory_production.ini.conf")
+	})
+}
+
+func TestConfig_SaveSSHConfigDir(t *testing.T) {
+	Convey("Testing Config.SaveSSHConfig() with SSHConfigDir", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		outputDir := filepath.Join(dir, "assh.d")
+		sshConfigPath := filepath.Join(dir, "config")
+		So(ioutil.WriteFile(sshConfigPath, []byte("Host mine\n  User me\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte(`SSHConfigDir: `+outputDir+`
+includes:
+- `+filepath.Join(dir, "web.yml")+`
+hosts:
+  aaa:
+    Port: 2222
+matches:
+- user: root
+  options:
+    ForwardAgent: no
+`), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "web.yml"), []byte("hosts:\n  web-*:\n    User: deploy\n"), 0644), ShouldBeNil)
+
+		load := func() *Config {
+			config := New()
+			config.sshConfigPath = sshConfigPath
+			So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+			return config
+		}
+
+		So(load().SaveSSHConfig(), ShouldBeNil)
+
+		names := []string{}
+		matches, _ := filepath.Glob(filepath.Join(outputDir, "*.conf"))
+		for _, match := range matches {
+			names = append(names, filepath.Base(match))
+		}
+		So(names, ShouldResemble, []string{"10-assh.conf", "10-web.conf", "80-matches.conf", "90-defaults.conf"})
+
+		content, err := ioutil.ReadFile(filepath.Join(outputDir, "10-web.conf"))
+		So(err, ShouldBeNil)
+		So(string(content), ShouldContainSubstring, "Host web-*\n  User deploy\n")
+		content, err = ioutil.ReadFile(filepath.Join(outputDir, "90-defaults.conf"))
+		So(err, ShouldBeNil)
+		So(string(content), ShouldContainSubstring, "Host *\n")
+
+		content, err = ioutil.ReadFile(sshConfigPath)
+		So(err, ShouldBeNil)
+		So(string(content), ShouldStartWith, "Host mine\n  User me\n\n# BEGIN assh")
+		So(string(content), ShouldContainSubstring, "Match all\nInclude "+filepath.Join(outputDir, "*.conf")+"\n# END assh\n")
+
+		Convey("Only the changed files are written", func() {
+			past := time.Now().Add(-time.Hour)
+			for _, match := range matches {
+				So(os.Chtimes(match, past, past), ShouldBeNil)
+			}
+			So(os.Chtimes(sshConfigPath, past, past), ShouldBeNil)
+
+			So(ioutil.WriteFile(filepath.Join(dir, "web.yml"), []byte("hosts:\n  web-*:\n    User: www\n"), 0644), ShouldBeNil)
+			So(load().SaveSSHConfig(), ShouldBeNil)
+
+			for _, match := range matches {
+				stat, err := os.Stat(match)
+				So(err, ShouldBeNil)
+				So(stat.ModTime().After(past), ShouldEqual, filepath.Base(match) == "10-web.conf")
+			}
+			stat, err := os.Stat(sshConfigPath)
+			So(err, ShouldBeNil)
+			So(stat.ModTime().Equal(past), ShouldBeTrue)
+		})
+
+		Convey("Stale files are removed", func() {
+			So(ioutil.WriteFile(filepath.Join(outputDir, "mine.conf"), []byte("Host mine\n"), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "web.yml"), []byte("{}\n"), 0644), ShouldBeNil)
+			So(load().SaveSSHConfig(), ShouldBeNil)
+
+			_, err := os.Stat(filepath.Join(outputDir, "10-web.conf"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+			_, err = os.Stat(filepath.Join(outputDir, "mine.conf"))
+			So(err, ShouldBeNil)
+		})
+	})
+}
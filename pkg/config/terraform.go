@@ -0,0 +1,190 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/flexyaml"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	RegisterInventoryProvider("terraform", newTerraformInventoryProvider)
+}
+
+// terraformMapping describes how the instances of a resource type are converted into hosts
+type terraformMapping struct {
+	// name and hostname are lists of attribute paths, the first non-empty value is used
+	name     []string
+	hostname []string
+	user     []string
+	port     []string
+	// host contains static assh options applied to every generated host (i.e: Inherits, Gateways)
+	host *Host
+}
+
+// terraformInventoryProvider reads a local terraform.tfstate file (format
+// version 4) and converts the instances of the mapped resource types into hosts
+type terraformInventoryProvider struct {
+	path     string
+	mappings map[string]*terraformMapping
+}
+
+func newTerraformInventoryProvider(include Include) (InventoryProvider, error) {
+	path, err := include.Path("path")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing path parameter")
+	}
+
+	mappings, ok := include.Params["mapping"].(map[string]interface{})
+	if !ok || len(mappings) == 0 {
+		return nil, fmt.Errorf("missing mapping parameter")
+	}
+
+	provider := &terraformInventoryProvider{
+		path:     path,
+		mappings: make(map[string]*terraformMapping),
+	}
+	for resourceType, value := range mappings {
+		mapping, err := newTerraformMapping(value)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %q: %v", resourceType, err)
+		}
+		provider.mappings[resourceType] = mapping
+	}
+	return provider, nil
+}
+
+func newTerraformMapping(value interface{}) (*terraformMapping, error) {
+	params, _ := value.(map[string]interface{})
+	mapping := &terraformMapping{
+		hostname: []string{"public_ip", "private_ip"},
+		host:     &Host{},
+	}
+	for key, param := range params {
+		switch strings.ToLower(key) {
+		case "name":
+			mapping.name = stringOrSlice(param)
+		case "hostname":
+			mapping.hostname = stringOrSlice(param)
+		case "user":
+			mapping.user = stringOrSlice(param)
+		case "port":
+			mapping.port = stringOrSlice(param)
+		case "host":
+			buf, err := yaml.Marshal(param)
+			if err != nil {
+				return nil, err
+			}
+			if err := flexyaml.Unmarshal(buf, mapping.host); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return mapping, nil
+}
+
+// Local implements the LocalInventoryProvider interface
+func (p *terraformInventoryProvider) Local() bool { return true }
+
+func (p *terraformInventoryProvider) Fetch() ([]byte, error) {
+	return ioutil.ReadFile(p.path)
+}
+
+type terraformState struct {
+	Version   int `json:"version"`
+	Resources []struct {
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+func (p *terraformInventoryProvider) Parse(raw []byte) (*Inventory, error) {
+	var state terraformState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", p.path, err)
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("%s: unsupported terraform state version %d", p.path, state.Version)
+	}
+
+	inventory := &Inventory{Hosts: make(HostsMap)}
+	for _, resource := range state.Resources {
+		mapping, found := p.mappings[resource.Type]
+		if !found || resource.Mode == "data" {
+			continue
+		}
+		for _, instance := range resource.Instances {
+			name := terraformAttribute(instance.Attributes, mapping.name)
+			if name == "" {
+				name = resource.Name
+				if instance.IndexKey != nil {
+					name = fmt.Sprintf("%s-%v", resource.Name, instance.IndexKey)
+				}
+			}
+
+			host := *mapping.host
+			host.name = name
+			if hostname := terraformAttribute(instance.Attributes, mapping.hostname); hostname != "" {
+				host.HostName = hostname
+			}
+			if user := terraformAttribute(instance.Attributes, mapping.user); user != "" {
+				host.User = user
+			}
+			if port := terraformAttribute(instance.Attributes, mapping.port); port != "" {
+				host.Port = port
+			}
+			inventory.Hosts[name] = &host
+		}
+	}
+	return inventory, nil
+}
+
+// terraformAttribute returns the first non-empty attribute among a list of
+// paths, a path is a list of keys and list indexes separated by dots (i.e:
+// "tags.Name" or "network_interface.0.access_config.0.nat_ip")
+func terraformAttribute(attributes map[string]interface{}, paths []string) string {
+	for _, path := range paths {
+		var value interface{} = attributes
+		for _, key := range strings.Split(path, ".") {
+			switch typed := value.(type) {
+			case map[string]interface{}:
+				value = typed[key]
+			case []interface{}:
+				idx, err := strconv.Atoi(key)
+				if err != nil || idx < 0 || idx >= len(typed) {
+					value = nil
+				} else {
+					value = typed[idx]
+				}
+			default:
+				value = nil
+			}
+		}
+
+		switch typed := value.(type) {
+		case nil, map[string]interface{}, []interface{}:
+			continue
+		case string:
+			if typed != "" {
+				return typed
+			}
+		default:
+			return fmt.Sprintf("%v", typed)
+		}
+	}
+	return ""
+}
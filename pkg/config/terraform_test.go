@@ -0,0 +1,146 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testTerraformState = `{
+  "version": 4,
+  "terraform_version": "0.12.24",
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "bastion",
+      "instances": [
+        {
+          "attributes": {
+            "public_ip": "52.1.2.3",
+            "private_ip": "10.0.0.2",
+            "tags": {"Name": "bastion"}
+          }
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "instances": [
+        {
+          "index_key": 0,
+          "attributes": {
+            "public_ip": "",
+            "private_ip": "10.0.1.10",
+            "tags": {}
+          }
+        },
+        {
+          "index_key": 1,
+          "attributes": {
+            "public_ip": "",
+            "private_ip": "10.0.1.11",
+            "tags": {"Name": "web-blue"}
+          }
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "google_compute_instance",
+      "name": "db",
+      "instances": [
+        {
+          "attributes": {
+            "name": "db-1",
+            "network_interface": [{"network_ip": "10.1.0.5", "access_config": []}]
+          }
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_security_group",
+      "name": "default",
+      "instances": [{"attributes": {"name": "default"}}]
+    }
+  ]
+}`
+
+func TestTerraformInventoryProvider(t *testing.T) {
+	Convey("Testing the terraform inventory provider", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(filepath.Join(dir, "terraform.tfstate"), []byte(testTerraformState), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.yml"), []byte(`hosts:
+  vpn:
+    Gateways: bastion
+templates:
+  aws:
+    User: ec2-user
+includes:
+- provider: terraform
+  path: terraform.tfstate
+  mapping:
+    aws_instance:
+      name: tags.Name
+      host:
+        Inherits: aws
+    google_compute_instance:
+      name: name
+      hostname:
+      - network_interface.0.access_config.0.nat_ip
+      - network_interface.0.network_ip
+      host:
+        Gateways: bastion
+`), 0644), ShouldBeNil)
+
+		config := New()
+		So(config.LoadFile(filepath.Join(dir, "assh.yml")), ShouldBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"bastion", "db-1", "vpn", "web-0", "web-blue"})
+
+		host, err := config.GetHost("bastion")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "52.1.2.3")
+		So(host.User, ShouldEqual, "ec2-user")
+
+		host, err = config.GetHost("web-0")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "10.0.1.10")
+
+		host, err = config.GetHost("db-1")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "10.1.0.5")
+		So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"bastion"})
+
+		origin, _ := config.OriginOf("hosts", "db-1")
+		So(origin.String(), ShouldStartWith, "terraform:")
+
+		Convey("Unsupported state", func() {
+			provider := &terraformInventoryProvider{path: "terraform.tfstate"}
+			_, err := provider.Parse([]byte(`{"version": 3}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "terraform.tfstate: unsupported terraform state version 3")
+		})
+
+		Convey("Invalid mapping", func() {
+			_, err := newTerraformInventoryProvider(Include{
+				Provider: "terraform",
+				Params: map[string]interface{}{
+					"path":    "terraform.tfstate",
+					"mapping": map[string]interface{}{"aws_instance": map[string]interface{}{"ip": "public_ip"}},
+				},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `mapping "aws_instance": unknown key "ip"`)
+		})
+	})
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Kinds of topology nodes and edges
+const (
+	TopologyHost       = "host"
+	TopologyTemplate   = "template"
+	TopologyUndeclared = "undeclared"
+	TopologyExternal   = "external"
+	TopologyInherits   = "inherits"
+	TopologyGateway    = "gateway"
+)
+
+// TopologyNode is a host, a template, an undeclared template or an external
+// gateway (a gateway reached by its hostname, without assh definition)
+type TopologyNode struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Unreachable hosts only have gateways that are part of a cycle
+	Unreachable bool `json:"unreachable,omitempty"`
+	// Error is the reason why the host cannot be computed (i.e: a circular
+	// inheritance), only its own gateways are shown
+	Error string `json:"error,omitempty"`
+}
+
+// TopologyEdge is an inheritance or a gateway reference between two nodes
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+	// Label is the gateway as written when it is a path (i.e: "gw1/gw2")
+	Label    string `json:"label,omitempty"`
+	Dangling bool   `json:"dangling,omitempty"`
+	Cycle    bool   `json:"cycle,omitempty"`
+}
+
+// Topology is the inheritance and gateway graph of the configuration
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+
+	nodes map[string]*TopologyNode
+}
+
+// Topology returns the inheritance graph (host -> templates) and the gateway
+// graph (host -> gateway -> gateway) of the configuration
+func (c *Config) Topology() *Topology {
+	t := &Topology{nodes: make(map[string]*TopologyNode)}
+	direct := map[string]bool{}
+
+	for _, section := range []struct {
+		kind  string
+		hosts HostsMap
+	}{
+		{TopologyHost, c.Hosts},
+		{TopologyTemplate, c.Templates},
+	} {
+		for name := range section.hosts {
+			t.addNode(name, section.kind)
+		}
+	}
+
+	// resolve returns the name of the definition matching a reference
+	resolve := func(name string, allowTemplate bool) (string, bool) {
+		host, err := c.matchHost(name, allowTemplate)
+		if err != nil || host == nil {
+			return name, false
+		}
+		if host.pattern != "" {
+			return host.pattern, true
+		}
+		return name, true
+	}
+
+	for _, name := range t.sortedNames(TopologyHost, TopologyTemplate) {
+		var definition *Host
+		if t.nodes[name].Kind == TopologyHost {
+			definition = c.Hosts[name]
+		} else {
+			definition = c.Templates[name]
+		}
+		for _, parent := range definition.Inherits {
+			target, found := resolve(strings.SplitN(parent, "/", 2)[0], true)
+			t.addEdge(TopologyEdge{From: name, To: target, Kind: TopologyInherits, Dangling: !found})
+		}
+
+		if t.nodes[name].Kind != TopologyHost {
+			continue
+		}
+		gateways := definition.Gateways
+		if host, err := c.getHostByName(name, true, true, false); err != nil {
+			t.nodes[name].Error = err.Error()
+		} else {
+			gateways = host.Gateways
+		}
+		for _, gateway := range gateways {
+			if gateway == "direct" {
+				direct[name] = true
+				continue
+			}
+			// only the last hop of a gateway path uses its own gateways, the
+			// undeclared gateways are reached directly by their hostname
+			parts := strings.Split(gateway, "/")
+			edge := TopologyEdge{From: name, Kind: TopologyGateway}
+			to, found := resolve(parts[len(parts)-1], false)
+			if !found {
+				t.addNode(to, TopologyExternal)
+			}
+			edge.To = to
+			if len(parts) > 1 {
+				edge.Label = gateway
+			}
+			t.addEdge(edge)
+		}
+	}
+
+	sort.Sort(topologyNodes(t.Nodes))
+	t.reindex()
+	t.markCycles(TopologyInherits)
+	t.markCycles(TopologyGateway)
+	t.markUnreachable(direct)
+	return t
+}
+
+type topologyNodes []TopologyNode
+
+func (n topologyNodes) Len() int           { return len(n) }
+func (n topologyNodes) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n topologyNodes) Less(i, j int) bool { return n[i].Name < n[j].Name }
+
+func (t *Topology) addNode(name, kind string) {
+	if _, found := t.nodes[name]; found {
+		return
+	}
+	t.Nodes = append(t.Nodes, TopologyNode{Name: name, Kind: kind})
+	t.reindex()
+}
+
+// reindex updates the index of the nodes, the Nodes slice may have been reallocated
+func (t *Topology) reindex() {
+	for idx := range t.Nodes {
+		t.nodes[t.Nodes[idx].Name] = &t.Nodes[idx]
+	}
+}
+
+func (t *Topology) addEdge(edge TopologyEdge) {
+	if edge.Dangling {
+		t.addNode(edge.To, TopologyUndeclared)
+	}
+	t.Edges = append(t.Edges, edge)
+}
+
+// sortedNames returns the names of the nodes of the given kinds, sorted
+func (t *Topology) sortedNames(kinds ...string) []string {
+	names := []string{}
+	for _, node := range t.Nodes {
+		for _, kind := range kinds {
+			if node.Kind == kind {
+				names = append(names, node.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// edgesFrom returns the edges of a kind starting from a node
+func (t *Topology) edgesFrom(name, kind string) []*TopologyEdge {
+	edges := []*TopologyEdge{}
+	for idx := range t.Edges {
+		if t.Edges[idx].From == name && t.Edges[idx].Kind == kind {
+			edges = append(edges, &t.Edges[idx])
+		}
+	}
+	return edges
+}
+
+// markCycles flags the edges of a kind belonging to a cycle, an edge is part
+// of a cycle if its target leads back to its source
+func (t *Topology) markCycles(kind string) {
+	reaches := func(from, to string) bool {
+		visited := map[string]bool{}
+		stack := []string{from}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if node == to {
+				return true
+			}
+			if visited[node] {
+				continue
+			}
+			visited[node] = true
+			for _, edge := range t.edgesFrom(node, kind) {
+				stack = append(stack, edge.To)
+			}
+		}
+		return false
+	}
+
+	for idx := range t.Edges {
+		edge := &t.Edges[idx]
+		if edge.Kind == kind && reaches(edge.To, edge.From) {
+			edge.Cycle = true
+		}
+	}
+}
+
+// markUnreachable flags the hosts without a gateway route free of cycles,
+// the edges without cycle form a DAG
+func (t *Topology) markUnreachable(direct map[string]bool) {
+	reachable := map[string]bool{}
+	var isReachable func(name string) bool
+	isReachable = func(name string) bool {
+		if result, found := reachable[name]; found {
+			return result
+		}
+		edges := t.edgesFrom(name, TopologyGateway)
+		result := len(edges) == 0 || direct[name]
+		for _, edge := range edges {
+			if !result && !edge.Cycle && isReachable(edge.To) {
+				result = true
+			}
+		}
+		reachable[name] = result
+		return result
+	}
+
+	for idx := range t.Nodes {
+		if t.Nodes[idx].Kind == TopologyHost {
+			t.Nodes[idx].Unreachable = !isReachable(t.Nodes[idx].Name)
+		}
+	}
+}
+
+// WriteASCIITo writes the inheritance and the gateway graphs as trees, the
+// roots are the hosts with inheritances or gateways
+func (t *Topology) WriteASCIITo(w io.Writer) error {
+	for _, section := range []struct {
+		title string
+		kind  string
+	}{
+		{"Inheritance", TopologyInherits},
+		{"Gateways", TopologyGateway},
+	} {
+		fmt.Fprintf(w, "%s:\n", section.title)
+		for _, name := range t.sortedNames(TopologyHost) {
+			if len(t.edgesFrom(name, section.kind)) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%s%s\n", name, t.markers(name, nil))
+			t.writeASCIIChildren(w, name, section.kind, "", map[string]bool{name: true})
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (t *Topology) writeASCIIChildren(w io.Writer, name, kind, prefix string, ancestors map[string]bool) {
+	edges := t.edgesFrom(name, kind)
+	for idx, edge := range edges {
+		branch, indent := "├── ", "│   "
+		if idx == len(edges)-1 {
+			branch, indent = "└── ", "    "
+		}
+		label := edge.To
+		if edge.Label != "" {
+			label = fmt.Sprintf("%s (%s)", edge.To, edge.Label)
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", prefix, branch, label, t.markers(edge.To, edge))
+
+		// cycles are only walked once
+		if ancestors[edge.To] {
+			continue
+		}
+		ancestors[edge.To] = true
+		t.writeASCIIChildren(w, edge.To, kind, prefix+indent, ancestors)
+		delete(ancestors, edge.To)
+	}
+}
+
+func (t *Topology) markers(name string, edge *TopologyEdge) string {
+	markers := []string{}
+	if node, found := t.nodes[name]; found {
+		if node.Kind != TopologyHost {
+			markers = append(markers, node.Kind)
+		}
+		if node.Unreachable {
+			markers = append(markers, "unreachable")
+		}
+		if node.Error != "" && edge == nil {
+			markers = append(markers, "error: "+node.Error)
+		}
+	}
+	if edge != nil && edge.Dangling && t.nodes[name].Kind != TopologyUndeclared {
+		markers = append(markers, "dangling")
+	}
+	if edge != nil && edge.Cycle {
+		markers = append(markers, "cycle")
+	}
+	if len(markers) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", strings.Join(markers, ", "))
+}
+
+// WriteDOTTo writes the graphs in the Graphviz DOT format, templates are
+// dashed, the inheritance edges are dotted, the undeclared templates, the
+// hosts in error or unreachable and cycles are red
+func (t *Topology) WriteDOTTo(w io.Writer) error {
+	fmt.Fprintln(w, "digraph assh {")
+	for _, name := range t.sortedNames(TopologyHost, TopologyTemplate, TopologyUndeclared, TopologyExternal) {
+		node := t.nodes[name]
+		attributes := []string{"shape=box"}
+		switch node.Kind {
+		case TopologyTemplate:
+			attributes = append(attributes, "style=dashed")
+		case TopologyUndeclared, TopologyExternal:
+			attributes = []string{"shape=plaintext"}
+		}
+		if node.Error != "" {
+			attributes = append(attributes, fmt.Sprintf("tooltip=%q", node.Error))
+		}
+		if node.Kind == TopologyUndeclared || node.Unreachable || node.Error != "" {
+			attributes = append(attributes, "color=red", "fontcolor=red")
+		}
+		fmt.Fprintf(w, "  %q [%s];\n", name, strings.Join(attributes, ", "))
+	}
+	for _, edge := range t.Edges {
+		label := edge.Kind
+		if edge.Label != "" {
+			label = edge.Label
+		}
+		attributes := []string{fmt.Sprintf("label=%q", label)}
+		if edge.Kind == TopologyInherits {
+			attributes = append(attributes, "style=dotted")
+		}
+		if edge.Cycle || edge.Dangling {
+			attributes = append(attributes, "color=red")
+		}
+		fmt.Fprintf(w, "  %q -> %q [%s];\n", edge.From, edge.To, strings.Join(attributes, ", "))
+	}
+	fmt.Fprintln(w, "}")
+	return nil
+}
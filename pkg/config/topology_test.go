@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testTopologyConfig = `hosts:
+  bastion:
+    HostName: 1.2.3.4
+  web:
+    Inherits: [prod, missing-template]
+    Gateways: bastion
+  db:
+    Gateways: [direct, ghost]
+  deep:
+    Gateways: web/bastion
+  loop-a:
+    Gateways: loop-b
+  loop-b:
+    Gateways: loop-a
+  lost:
+    Gateways: ghost
+  broken:
+    Inherits: cycle-a
+    Gateways: bastion
+templates:
+  prod:
+    User: deploy
+  cycle-a:
+    Inherits: cycle-b
+  cycle-b:
+    Inherits: cycle-a
+`
+
+func TestConfig_Topology(t *testing.T) {
+	Convey("Testing Config.Topology()", t, FailureContinues, func() {
+		config := New()
+		So(config.LoadConfig(strings.NewReader(testTopologyConfig)), ShouldBeNil)
+		topology := config.Topology()
+
+		nodes := map[string]TopologyNode{}
+		for _, node := range topology.Nodes {
+			nodes[node.Name] = node
+		}
+		So(nodes["prod"].Kind, ShouldEqual, TopologyTemplate)
+		So(nodes["missing-template"].Kind, ShouldEqual, TopologyUndeclared)
+		So(nodes["ghost"].Kind, ShouldEqual, TopologyExternal)
+		So(nodes["web"].Unreachable, ShouldBeFalse)
+		So(nodes["deep"].Unreachable, ShouldBeFalse)
+		So(nodes["db"].Unreachable, ShouldBeFalse)
+		So(nodes["lost"].Unreachable, ShouldBeFalse)
+		So(nodes["loop-a"].Unreachable, ShouldBeTrue)
+		So(nodes["loop-b"].Unreachable, ShouldBeTrue)
+		So(nodes["broken"].Error, ShouldStartWith, "circular inheritance: ")
+		So(nodes["web"].Error, ShouldEqual, "")
+
+		for _, edge := range topology.Edges {
+			switch edge.From {
+			case "loop-a", "loop-b":
+				So(edge.Cycle, ShouldBeTrue)
+			case "lost":
+				So(edge.To, ShouldEqual, "ghost")
+				So(edge.Dangling, ShouldBeFalse)
+			case "broken":
+				if edge.Kind == TopologyGateway {
+					So(edge.To, ShouldEqual, "bastion")
+				}
+			case "deep":
+				So(edge.To, ShouldEqual, "bastion")
+				So(edge.Label, ShouldEqual, "web/bastion")
+				So(edge.Cycle || edge.Dangling, ShouldBeFalse)
+			}
+		}
+
+		Convey("ASCII output", func() {
+			var buffer bytes.Buffer
+			So(topology.WriteASCIITo(&buffer), ShouldBeNil)
+			So(buffer.String(), ShouldEqual, `Inheritance:
+broken [error: circular inheritance: cycle-a -> cycle-b -> cycle-a]
+└── cycle-a [template]
+    └── cycle-b [template, cycle]
+        └── cycle-a [template, cycle]
+web
+├── prod [template]
+└── missing-template [undeclared]
+
+Gateways:
+broken [error: circular inheritance: cycle-a -> cycle-b -> cycle-a]
+└── bastion
+db
+└── ghost [external]
+deep
+└── bastion (web/bastion)
+loop-a [unreachable]
+└── loop-b [unreachable, cycle]
+    └── loop-a [unreachable, cycle]
+loop-b [unreachable]
+└── loop-a [unreachable, cycle]
+    └── loop-b [unreachable, cycle]
+lost
+└── ghost [external]
+web
+└── bastion
+
+`)
+		})
+
+		Convey("DOT output", func() {
+			var buffer bytes.Buffer
+			So(topology.WriteDOTTo(&buffer), ShouldBeNil)
+			output := buffer.String()
+			So(output, ShouldStartWith, "digraph assh {\n")
+			So(output, ShouldContainSubstring, `  "prod" [shape=box, style=dashed];`)
+			So(output, ShouldContainSubstring, `  "ghost" [shape=plaintext];`)
+			So(output, ShouldContainSubstring, `  "missing-template" [shape=plaintext, color=red, fontcolor=red];`)
+			So(output, ShouldContainSubstring, `  "lost" [shape=box];`)
+			So(output, ShouldContainSubstring, `  "broken" [shape=box, tooltip="circular inheritance: cycle-a -> cycle-b -> cycle-a", color=red, fontcolor=red];`)
+			So(output, ShouldContainSubstring, `  "web" -> "prod" [label="inherits", style=dotted];`)
+			So(output, ShouldContainSubstring, `  "deep" -> "bastion" [label="web/bastion"];`)
+			So(output, ShouldContainSubstring, `  "loop-a" -> "loop-b" [label="gateway", color=red];`)
+			So(output, ShouldEndWith, "}\n")
+		})
+
+		Convey("JSON output", func() {
+			out, err := json.Marshal(topology)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldContainSubstring, `{"name":"lost","kind":"host"}`)
+			So(string(out), ShouldContainSubstring, `{"name":"ghost","kind":"external"}`)
+			So(string(out), ShouldContainSubstring, `{"from":"lost","to":"ghost","kind":"gateway"}`)
+			So(string(out), ShouldContainSubstring, `{"name":"broken","kind":"host","error":"circular inheritance: cycle-a -\u003e cycle-b -\u003e cycle-a"}`)
+		})
+	})
+}
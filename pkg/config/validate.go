@@ -0,0 +1,521 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/noqqe/advanced-ssh-config/pkg/flexyaml"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is an issue found while validating a configuration
+type Diagnostic struct {
+	File     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+// String returns a "file:line: severity: message" representation of the diagnostic
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Line > 0 {
+		location = fmt.Sprintf("%s:%d", d.File, d.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, d.Severity, d.Message)
+}
+
+// Diagnostics is a list of Diagnostic
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Len() int      { return len(d) }
+func (d Diagnostics) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d Diagnostics) Less(i, j int) bool {
+	if d[i].File != d[j].File {
+		return d[i].File < d[j].File
+	}
+	if d[i].Line != d[j].Line {
+		return d[i].Line < d[j].Line
+	}
+	return d[i].Message < d[j].Message
+}
+
+// HasErrors returns true if at least one diagnostic has the error severity
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	configKeys    = yamlKeys(reflect.TypeOf(Config{}))
+	hostKeys      = yamlKeys(reflect.TypeOf(Host{}))
+	hostHooksKeys = yamlKeys(reflect.TypeOf(HostHooks{}))
+	profileKeys   = yamlKeys(reflect.TypeOf(Profile{}))
+	locationKeys  = yamlKeys(reflect.TypeOf(Location{}))
+	matchKeys     = yamlKeys(reflect.TypeOf(MatchBlock{}))
+
+	yamlLineErrorRegex = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+// yamlKeys returns the lowercased yaml keys of a struct type
+func yamlKeys(structType reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	for i := 0; i < structType.NumField(); i++ {
+		tag := structType.Field(i).Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		keys[strings.ToLower(name)] = true
+	}
+	return keys
+}
+
+type validator struct {
+	config      *Config
+	diagnostics Diagnostics
+	hostOrigins map[string]Diagnostic
+}
+
+// Validate checks every included file of the configuration and returns the
+// list of issues: unknown keys, wrong value types, references to unknown
+// hosts, invalid patterns, inheritance cycles, gateway loops and conflicting
+// redefinitions across includes
+func (c *Config) Validate() Diagnostics {
+	v := validator{
+		config:      c,
+		hostOrigins: make(map[string]Diagnostic),
+	}
+
+	files := c.IncludedFiles()
+	sort.Strings(files)
+	for _, file := range files {
+		v.validateFile(file)
+	}
+	v.validateGatewayLoops()
+	v.diagnostics = append(v.diagnostics, c.Redefinitions()...)
+	v.diagnostics = append(v.diagnostics, c.untrusted...)
+
+	sort.Sort(v.diagnostics)
+	return v.diagnostics
+}
+
+func (v *validator) add(file string, line int, severity string, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		File:     file,
+		Line:     line,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validateFile(file string) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		v.add(file, 0, SeverityError, "%v", err)
+		return
+	}
+	format := DetectFormat(file, buf)
+	if IsEncrypted(buf) {
+		if buf, format, err = v.config.decryptConfig(buf, file); err != nil {
+			v.add(file, 0, SeverityError, "%v", err)
+			return
+		}
+	}
+	if buf, err = configToYAML(buf, format); err != nil {
+		v.add(file, 0, SeverityError, "%v", err)
+		return
+	}
+
+	// wrong value types and syntax errors
+	var typed Config
+	if err := flexyaml.Unmarshal(buf, &typed); err != nil {
+		for _, msg := range strings.Split(err.Error(), "\n") {
+			if match := yamlLineErrorRegex.FindStringSubmatch(msg); match != nil {
+				// the lines of the YAML conversion of the JSON and TOML files are meaningless
+				line := 0
+				if format == FormatYAML {
+					line, _ = strconv.Atoi(match[1])
+				}
+				v.add(file, line, SeverityError, "%s", match[2])
+			}
+		}
+	}
+
+	var raw map[interface{}]interface{}
+	if err := flexyaml.Unmarshal(buf, &raw); err != nil {
+		return
+	}
+	lines := map[string]int{}
+	if format == FormatYAML {
+		lines = flexyaml.KeyLines(buf)
+	}
+	lineOf := func(keys ...string) int {
+		for len(keys) > 0 {
+			if line, found := lines[strings.ToLower(strings.Join(keys, "/"))]; found {
+				return line
+			}
+			keys = keys[:len(keys)-1]
+		}
+		return 0
+	}
+
+	for key, value := range raw {
+		section := fmt.Sprintf("%v", key)
+		if !configKeys[strings.ToLower(section)] {
+			v.add(file, lineOf(section), SeverityError, "unknown key %q%s", section, suggestKey(section, configKeys))
+			continue
+		}
+
+		switch section = strings.ToLower(section); section {
+		case "hosts", "templates":
+			entries, _ := value.(map[interface{}]interface{})
+			for name, entry := range entries {
+				v.validateHost(file, lineOf, section, fmt.Sprintf("%v", name), entry)
+			}
+		case "defaults":
+			v.validateHost(file, lineOf, section, "", value)
+		case "profiles":
+			profiles, _ := value.(map[interface{}]interface{})
+			for name, profile := range profiles {
+				v.validateProfile(file, lineOf, fmt.Sprintf("%v", name), profile)
+			}
+		case "matches":
+			matches, _ := value.([]interface{})
+			for _, match := range matches {
+				v.validateMatch(file, lineOf(section), match)
+			}
+		case "includes":
+			includes, _ := value.([]interface{})
+			for _, include := range includes {
+				if params, isMap := include.(map[interface{}]interface{}); isMap {
+					v.validateInventory(file, lineOf(section), params)
+					continue
+				}
+				if _, err := filepath.Glob(fmt.Sprintf("%v", include)); err != nil {
+					v.add(file, lineOf(section), SeverityError, "invalid include pattern %q: %v", include, err)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateHost(file string, lineOf func(...string) int, section, name string, value interface{}) {
+	keys := []string{section}
+	if name != "" {
+		keys = append(keys, name)
+	}
+	line := lineOf(keys...)
+
+	if section == "hosts" {
+		v.hostOrigins[name] = Diagnostic{File: file, Line: line}
+		if _, err := path.Match(name, ""); err != nil {
+			v.add(file, line, SeverityError, "invalid host pattern %q: %v", name, err)
+		}
+	}
+
+	fields, _ := value.(map[interface{}]interface{})
+	for key, fieldValue := range fields {
+		field := fmt.Sprintf("%v", key)
+		fieldLine := lineOf(append(keys, field)...)
+		if !hostKeys[strings.ToLower(field)] {
+			v.add(file, fieldLine, SeverityError, "unknown key %q%s", field, suggestKey(field, hostKeys))
+			continue
+		}
+
+		switch strings.ToLower(field) {
+		case "hooks":
+			hooks, _ := fieldValue.(map[interface{}]interface{})
+			for hook := range hooks {
+				hookName := fmt.Sprintf("%v", hook)
+				if !hostHooksKeys[strings.ToLower(hookName)] {
+					v.add(file, lineOf(append(keys, field, hookName)...), SeverityError, "unknown hook %q%s", hookName, suggestKey(hookName, hostHooksKeys))
+				}
+			}
+		case "inherits":
+			for _, target := range stringOrSlice(fieldValue) {
+				targetName := strings.SplitN(target, "/", 2)[0]
+				if host, err := v.config.matchHost(targetName, true); err == nil && host == nil {
+					v.add(file, fieldLine, SeverityError, "%q inherits from unknown host %q", name, target)
+				}
+			}
+		case "gateways":
+			for _, gateway := range stringOrSlice(fieldValue) {
+				if gateway == "direct" {
+					continue
+				}
+				for _, part := range strings.Split(gateway, "/") {
+					if host, err := v.config.matchHost(part, false); err == nil && host == nil {
+						v.add(file, fieldLine, SeverityWarning, "gateway %q is not a declared host, it will be used as a raw hostname", part)
+					}
+				}
+			}
+		case "locations":
+			locations, _ := fieldValue.([]interface{})
+			for _, location := range locations {
+				v.validateLocation(file, fieldLine, location)
+			}
+		case "aliases":
+			for _, alias := range stringOrSlice(fieldValue) {
+				if _, err := path.Match(alias, ""); err != nil {
+					v.add(file, fieldLine, SeverityError, "invalid alias pattern %q: %v", alias, err)
+				}
+			}
+		}
+	}
+
+	if section == "hosts" {
+		if host, found := v.config.Hosts[name]; found {
+			if _, err := computeHost(host, v.config, name, false); err != nil {
+				v.add(file, line, SeverityError, "%v", err)
+			}
+		}
+	}
+}
+
+func (v *validator) validateProfile(file string, lineOf func(...string) int, name string, value interface{}) {
+	if err := checkProfileName(name); err != nil {
+		v.add(file, lineOf("profiles", name), SeverityError, "%v", err)
+	}
+	sections, _ := value.(map[interface{}]interface{})
+	for key, sectionValue := range sections {
+		section := fmt.Sprintf("%v", key)
+		prefix := "profiles/" + name + "/" + strings.ToLower(section)
+		switch strings.ToLower(section) {
+		case "hosts", "templates":
+			entries, _ := sectionValue.(map[interface{}]interface{})
+			for hostName, entry := range entries {
+				v.validateHost(file, lineOf, prefix, fmt.Sprintf("%v", hostName), entry)
+			}
+		case "defaults":
+			v.validateHost(file, lineOf, prefix, "", sectionValue)
+		default:
+			v.add(file, lineOf("profiles", name, section), SeverityError, "unknown key %q%s", section, suggestKey(section, profileKeys))
+		}
+	}
+}
+
+func (v *validator) validateMatch(file string, line int, value interface{}) {
+	fields, _ := value.(map[interface{}]interface{})
+	for key, fieldValue := range fields {
+		field := fmt.Sprintf("%v", key)
+		if !matchKeys[strings.ToLower(field)] {
+			v.add(file, line, SeverityError, "unknown match key %q%s", field, suggestKey(field, matchKeys))
+			continue
+		}
+		switch strings.ToLower(field) {
+		case "position":
+			position := strings.ToLower(fmt.Sprintf("%v", fieldValue))
+			if position != MatchPositionBefore && position != MatchPositionAfter {
+				v.add(file, line, SeverityError, "invalid match position %q, expected %q or %q", fieldValue, MatchPositionBefore, MatchPositionAfter)
+			}
+		case "options":
+			options, _ := fieldValue.(map[interface{}]interface{})
+			for option := range options {
+				optionName := fmt.Sprintf("%v", option)
+				if !hostKeys[strings.ToLower(optionName)] {
+					v.add(file, line, SeverityError, "unknown key %q%s", optionName, suggestKey(optionName, hostKeys))
+				}
+			}
+		case "exec":
+			if err := (&MatchBlock{Exec: fmt.Sprintf("%v", fieldValue)}).validate(); err != nil {
+				v.add(file, line, SeverityError, "%v", err)
+			}
+		case "host", "originalhost", "user", "localuser":
+			for _, patterns := range stringOrSlice(fieldValue) {
+				for _, pattern := range strings.Split(patterns, ",") {
+					if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+						v.add(file, line, SeverityError, "invalid match pattern %q: %v", pattern, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateLocation(file string, line int, value interface{}) {
+	conditions, _ := value.(map[interface{}]interface{})
+	for key, conditionValue := range conditions {
+		condition := fmt.Sprintf("%v", key)
+		if !locationKeys[strings.ToLower(condition)] {
+			v.add(file, line, SeverityError, "unknown location key %q%s", condition, suggestKey(condition, locationKeys))
+			continue
+		}
+		switch strings.ToLower(condition) {
+		case "cidr":
+			for _, cidr := range stringOrSlice(conditionValue) {
+				if _, _, err := net.ParseCIDR(cidr); err != nil {
+					v.add(file, line, SeverityError, "invalid location cidr %q", cidr)
+				}
+			}
+		case "route":
+			for _, route := range stringOrSlice(conditionValue) {
+				if net.ParseIP(route) == nil {
+					v.add(file, line, SeverityError, "invalid location route address %q", route)
+				}
+			}
+		case "probe":
+			if _, _, err := net.SplitHostPort(fmt.Sprintf("%v", conditionValue)); err != nil {
+				v.add(file, line, SeverityError, "invalid location probe %q: %v", conditionValue, err)
+			}
+		}
+	}
+}
+
+func (v *validator) validateInventory(file string, line int, params map[interface{}]interface{}) {
+	provider := ""
+	for key, value := range params {
+		if strings.ToLower(fmt.Sprintf("%v", key)) == "provider" {
+			provider = fmt.Sprintf("%v", value)
+		}
+	}
+	if provider == "" {
+		v.add(file, line, SeverityError, "include entries must be a file pattern or have a provider")
+		return
+	}
+	if _, found := inventoryProviders[provider]; !found {
+		v.add(file, line, SeverityError, "unknown inventory provider %q", provider)
+	}
+}
+
+// validateGatewayLoops detects hosts that would be reached through themselves
+func (v *validator) validateGatewayLoops() {
+	edges := map[string][]string{}
+	var gatewaysOf func(name string) []string
+	gatewaysOf = func(name string) []string {
+		if targets, found := edges[name]; found {
+			return targets
+		}
+		edges[name] = []string{}
+		host, err := v.config.getHostByName(name, true, true, false)
+		if err != nil {
+			return nil
+		}
+		targets := []string{}
+		for _, gateway := range host.Gateways {
+			if gateway == "direct" {
+				continue
+			}
+			// only the last hop of a gateway path uses its own gateways
+			parts := strings.Split(gateway, "/")
+			targets = append(targets, v.config.canonicalName(parts[len(parts)-1]))
+		}
+		edges[name] = targets
+		return targets
+	}
+
+	// depth-first search, visited nodes are either on the current stack
+	// (true) or fully explored (false)
+	visited := map[string]bool{}
+	stack := []string{}
+	var walk func(node string)
+	walk = func(node string) {
+		if onStack, found := visited[node]; found {
+			if onStack {
+				idx := 0
+				for stack[idx] != node {
+					idx++
+				}
+				cycle := append(append([]string{}, stack[idx:]...), node)
+				origin := v.hostOrigins[node]
+				v.add(origin.File, origin.Line, SeverityError, "gateway loop: %s", strings.Join(cycle, " -> "))
+			}
+			return
+		}
+		visited[node] = true
+		stack = append(stack, node)
+		for _, target := range gatewaysOf(node) {
+			walk(target)
+		}
+		stack = stack[:len(stack)-1]
+		visited[node] = false
+	}
+	for _, name := range v.config.sortedNames() {
+		walk(name)
+	}
+}
+
+// canonicalName returns the name of the host definition matching name, or name itself
+func (c *Config) canonicalName(name string) string {
+	matches, err := c.candidates(name, false)
+	if err != nil || len(matches) == 0 {
+		return name
+	}
+	return matches[0].Name
+}
+
+func stringOrSlice(value interface{}) []string {
+	switch typed := value.(type) {
+	case []interface{}:
+		ret := []string{}
+		for _, entry := range typed {
+			ret = append(ret, fmt.Sprintf("%v", entry))
+		}
+		return ret
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprintf("%v", typed)}
+	}
+}
+
+// suggestKey returns a hint about the closest known key
+func suggestKey(key string, known map[string]bool) string {
+	key = strings.ToLower(key)
+	best := ""
+	bestDistance := 3
+	for candidate := range known {
+		if distance := levenshtein(key, candidate); distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	Convey("Testing Config.Validate()", t, FailureContinues, func() {
+		file, err := ioutil.TempFile(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		file.Write([]byte(`hosts:
+  aaa:
+    HostName: 1.2.3.4
+    Gatways: bbb
+  bbb:
+    Inherits: zzz
+    Gateways:
+    - direct
+    - ccc
+  ccc:
+    Gateways: ddd
+  ddd:
+    Gateways: ccc
+  fff:
+    Hooks:
+      OnConect:
+      - write hello
+  ggg:
+    Gateways: unknown.example.com
+templates:
+  tpl:
+    User: toor
+defaults:
+  Port: 22
+foo: bar
+`))
+		file.Close()
+
+		config := New()
+		So(config.LoadFiles(file.Name()), ShouldBeNil)
+
+		diagnostics := config.Validate()
+		So(diagnostics.HasErrors(), ShouldBeTrue)
+
+		messages := []string{}
+		for _, diagnostic := range diagnostics {
+			messages = append(messages, diagnostic.String())
+		}
+		prefix := file.Name()
+		So(messages, ShouldResemble, []string{
+			fmt.Sprintf("%s:4: error: unknown key \"Gatways\", did you mean \"gateways\"?", prefix),
+			fmt.Sprintf("%s:6: error: \"bbb\" inherits from unknown host \"zzz\"", prefix),
+			fmt.Sprintf("%s:10: error: gateway loop: ccc -> ddd -> ccc", prefix),
+			fmt.Sprintf("%s:16: error: unknown hook \"OnConect\", did you mean \"onconnect\"?", prefix),
+			fmt.Sprintf("%s:19: warning: gateway \"unknown.example.com\" is not a declared host, it will be used as a raw hostname", prefix),
+			fmt.Sprintf("%s:25: error: unknown key \"foo\"", prefix),
+		})
+
+		Convey("Invalid patterns and values", func() {
+			file, err := ioutil.TempFile(os.TempDir(), "assh-tests")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			file.Write([]byte(`hosts:
+  "aaa[":
+    Port: 22
+  bbb:
+    ConnectTimeout: abc
+  ccc:
+    Locations:
+    - cidr: 10.0.0.0/64
+      route: gw
+      proba: intranet:22
+matches:
+- position: middle
+  hots: "*.corp"
+  exec: grep -q "corp" /etc/resolv.conf
+`))
+			file.Close()
+
+			config := New()
+			So(config.LoadFiles(file.Name()), ShouldBeNil)
+
+			messages := []string{}
+			for _, diagnostic := range config.Validate() {
+				messages = append(messages, diagnostic.String())
+			}
+			So(messages, ShouldResemble, []string{
+				fmt.Sprintf("%s:2: error: invalid host pattern \"aaa[\": syntax error in pattern", file.Name()),
+				fmt.Sprintf("%s:5: error: cannot unmarshal !!str `abc` into int", file.Name()),
+				fmt.Sprintf("%s:7: error: invalid location cidr \"10.0.0.0/64\"", file.Name()),
+				fmt.Sprintf("%s:7: error: invalid location route address \"gw\"", file.Name()),
+				fmt.Sprintf("%s:7: error: unknown location key \"proba\", did you mean \"probe\"?", file.Name()),
+				fmt.Sprintf("%s:11: error: invalid match position \"middle\", expected \"before\" or \"after\"", file.Name()),
+				fmt.Sprintf("%s:11: error: match exec \"grep -q \\\"corp\\\" /etc/resolv.conf\": double quotes and newlines are not supported by ssh_config", file.Name()),
+				fmt.Sprintf("%s:11: error: unknown match key \"hots\", did you mean \"host\"?", file.Name()),
+			})
+		})
+
+		Convey("A valid configuration has no diagnostics", func() {
+			file, err := ioutil.TempFile(os.TempDir(), "assh-tests")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			file.Write([]byte(yamlConfig))
+			file.Close()
+
+			config := New()
+			So(config.LoadFiles(file.Name()), ShouldBeNil)
+			So(config.Validate().HasErrors(), ShouldBeFalse)
+		})
+	})
+}
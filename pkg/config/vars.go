@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// varRegex matches the `{{ .Vars.name }}` references
+var varRegex = regexp.MustCompile(`\{\{\s*\.Vars\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// hostVars returns the variables available for a host, the host variables
+// (including the inherited ones) override the defaults and global variables
+func (c *Config) hostVars(host *Host) map[string]string {
+	vars := make(map[string]string)
+	for _, source := range []map[string]string{c.Vars, c.Defaults.Vars, host.Vars} {
+		for key, value := range source {
+			vars[key] = value
+		}
+	}
+	return vars
+}
+
+// renderVars replaces the `{{ .Vars.name }}` references in the string fields
+// of a host, including the ones of nested structures such as the hooks and
+// the locations, referencing an undefined variable is an error
+func renderVars(host *Host, vars map[string]string) error {
+	return renderValue(reflect.ValueOf(host).Elem(), "", vars)
+}
+
+// renderValue renders the variables of value in place, path is the name of
+// the field used in errors
+func renderValue(value reflect.Value, path string, vars map[string]string) error {
+	switch value.Kind() {
+	case reflect.String:
+		rendered, err := renderString(value.String(), vars)
+		if err != nil {
+			return fmt.Errorf("%v in %s", err, path)
+		}
+		value.SetString(rendered)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := field.Name
+			if path != "" {
+				fieldPath = path + "." + field.Name
+			}
+			if err := renderValue(value.Field(i), fieldPath, vars); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if value.IsNil() || value.Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		// pointed structures may be shared with other hosts
+		rendered := reflect.New(value.Elem().Type())
+		rendered.Elem().Set(value.Elem())
+		if err := renderValue(rendered.Elem(), path, vars); err != nil {
+			return err
+		}
+		value.Set(rendered)
+	case reflect.Slice:
+		if value.Len() == 0 {
+			return nil
+		}
+		// slices may be shared with other hosts
+		rendered := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		reflect.Copy(rendered, value)
+		for i := 0; i < rendered.Len(); i++ {
+			entryPath := path
+			if rendered.Index(i).Kind() == reflect.Struct {
+				entryPath = fmt.Sprintf("%s[%d]", path, i)
+			}
+			if err := renderValue(rendered.Index(i), entryPath, vars); err != nil {
+				return err
+			}
+		}
+		value.Set(rendered)
+	}
+	return nil
+}
+
+func renderString(input string, vars map[string]string) (string, error) {
+	var err error
+	output := varRegex.ReplaceAllStringFunc(input, func(match string) string {
+		name := varRegex.FindStringSubmatch(match)[1]
+		value, found := vars[name]
+		if !found && err == nil {
+			err = fmt.Errorf("undefined variable %q", name)
+		}
+		return value
+	})
+	return output, err
+}
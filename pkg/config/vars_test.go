@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	composeyaml "github.com/docker/libcompose/yaml"
+	"github.com/noqqe/advanced-ssh-config/pkg/hooks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig_Vars(t *testing.T) {
+	Convey("Testing user-defined variables", t, FailureContinues, func() {
+		config := New()
+		So(config.LoadConfig(strings.NewReader(`vars:
+  domain: example.com
+  bastion: gw.example.com
+hosts:
+  aaa:
+    HostName: aaa.{{ .Vars.domain }}
+    Gateways: "{{.Vars.bastion}}"
+  bbb:
+    Inherits: tpl
+    HostName: bbb.{{ .Vars.domain }}
+    IdentityFile: ~/.ssh/{{ .Vars.key }}
+  ccc:
+    HostName: ccc.{{ .Vars.unknown }}
+  ddd:
+    Vars:
+      domain: example.org
+    Hooks:
+      OnConnect:
+      - exec echo {{.Host.Name}}
+templates:
+  tpl:
+    Vars:
+      domain: example.net
+      key: id_team
+defaults:
+  User: admin
+  ControlPath: ~/.ssh/cm/{{ .Vars.user }}-%h.sock
+  Vars:
+    user: bob
+`)), ShouldBeNil)
+
+		host, err := config.GetHost("aaa")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "aaa.example.com")
+		So(host.Gateways, ShouldResemble, composeyaml.Stringorslice{"gw.example.com"})
+		So(host.ControlPath, ShouldEqual, "~/.ssh/cm/bob-%h.sock")
+
+		host, err = config.GetHost("bbb")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "bbb.example.net")
+		So(host.IdentityFile, ShouldResemble, composeyaml.Stringorslice{"~/.ssh/id_team"})
+
+		host, err = config.GetHost("ddd")
+		So(err, ShouldBeNil)
+		So(host.HostName, ShouldEqual, "ddd")
+		So(host.Hooks.OnConnect, ShouldResemble, hooks.Hooks{"exec echo {{.Host.Name}}"})
+
+		_, err = config.GetHost("ccc")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `host "ccc": undefined variable "unknown" in HostName`)
+
+		var buffer bytes.Buffer
+		err = config.WriteSSHConfigTo(&buffer)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `host "ccc": undefined variable "unknown" in HostName`)
+
+		delete(config.Hosts, "ccc")
+		buffer.Reset()
+		So(config.WriteSSHConfigTo(&buffer), ShouldBeNil)
+		So(buffer.String(), ShouldContainSubstring, "  # HostName: bbb.example.net\n")
+		So(buffer.String(), ShouldContainSubstring, "  ControlPath ~/.ssh/cm/bob-%h.sock\n")
+	})
+
+	Convey("Testing user-defined variables in nested fields", t, FailureContinues, func() {
+		config := New()
+		So(config.LoadConfig(strings.NewReader(`vars:
+  bastion: gw.example.com
+hosts:
+  aaa:
+    Locations:
+    - Name: office
+      Probe: "{{ .Vars.bastion }}:22"
+      Gateways: ["{{ .Vars.bastion }}", direct]
+  bbb:
+    Vars:
+      bastion: gw.example.org
+  ccc:
+    Locations:
+    - Gateways: "{{ .Vars.unknown }}"
+  ddd:
+    Hooks:
+      OnConnect:
+      - exec echo {{ .Vars.unknown }}
+  gw:
+    User: "{{ .Vars.gwuser }}"
+defaults:
+  Hooks:
+    OnConnect:
+    - exec echo {{.Host.Name}} via {{ .Vars.bastion }}
+`)), ShouldBeNil)
+
+		host, err := config.GetHost("aaa")
+		So(err, ShouldBeNil)
+		So(host.Locations, ShouldHaveLength, 1)
+		So(host.Locations[0].Probe, ShouldEqual, "gw.example.com:22")
+		So(host.Locations[0].Gateways, ShouldResemble, composeyaml.Stringorslice{"gw.example.com", "direct"})
+		So(config.Hosts["aaa"].Locations[0].Probe, ShouldEqual, "{{ .Vars.bastion }}:22")
+		So(host.Hooks.OnConnect, ShouldResemble, hooks.Hooks{"exec echo {{.Host.Name}} via gw.example.com"})
+
+		host, err = config.GetHost("bbb")
+		So(err, ShouldBeNil)
+		So(host.Hooks.OnConnect, ShouldResemble, hooks.Hooks{"exec echo {{.Host.Name}} via gw.example.org"})
+		So(config.Defaults.Hooks.OnConnect, ShouldResemble, hooks.Hooks{"exec echo {{.Host.Name}} via {{ .Vars.bastion }}"})
+
+		_, err = config.GetHost("ccc")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `host "ccc": undefined variable "unknown" in Locations[0].Gateways`)
+
+		_, err = config.GetHost("ddd")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `host "ddd": undefined variable "unknown" in Hooks.OnConnect`)
+
+		_, err = config.GetGatewaySafe("gw")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, `host "gw": undefined variable "gwuser" in User`)
+	})
+}
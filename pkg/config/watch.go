@@ -0,0 +1,251 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/noqqe/advanced-ssh-config/pkg/logger"
+	"github.com/noqqe/advanced-ssh-config/pkg/utils"
+)
+
+// DefaultWatchDelay is the time the changes are given to settle before a rebuild,
+// editors and version control tools often write several files in a row
+const DefaultWatchDelay = 200 * time.Millisecond
+
+// dirWatcher notifies the changes of the entries of directories, the events
+// are the paths of the created, written, renamed or removed entries and of
+// the watched directories themselves when they are removed
+type dirWatcher interface {
+	// Add watches a directory, watching a directory twice is a no-op
+	Add(dir string) error
+	Events() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// Watcher rebuilds the SSH configuration each time the assh configuration,
+// an included file, a file matching an include pattern or another file read
+// by the configuration (inventories, signatures) changes, and when the cached
+// inventories expire
+type Watcher struct {
+	// Path is the main configuration file
+	Path string
+	// Delay is the time without changes waited before rebuilding
+	Delay time.Duration
+	// OnRebuild is called after each rebuild, with the loaded configuration
+	// or the error
+	OnRebuild func(*Config, error)
+
+	load     func(path string) (*Config, error)
+	patterns []string
+}
+
+// NewWatcher returns a Watcher of the configuration file path
+func NewWatcher(path string) *Watcher {
+	return &Watcher{
+		Path:  path,
+		Delay: DefaultWatchDelay,
+		load:  Open,
+	}
+}
+
+// Run rebuilds the SSH configuration and then watches the configuration
+// files until stop is closed
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	watcher, err := newDirWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	var settled <-chan time.Time
+	if settled, err = w.rebuild(watcher); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err := <-watcher.Errors():
+			Logger.Warnf("Watch error: %v", err)
+		case path := <-watcher.Events():
+			if w.matches(path) {
+				Logger.Debugf("%s changed", path)
+				settled = time.After(w.Delay)
+			}
+		case <-settled:
+			if settled, err = w.rebuild(watcher); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rebuild loads the configuration, saves the SSH configuration and watches
+// the directories of the files it was loaded from. The errors of the
+// configuration are reported, only the errors of the watcher are returned.
+// The returned channel fires when another rebuild is needed, right away or
+// when the first cached inventory expires.
+func (w *Watcher) rebuild(watcher dirWatcher) (<-chan time.Time, error) {
+	config, loadErr := w.load(w.Path)
+	if loadErr == nil {
+		loadErr = config.SaveSSHConfig()
+	}
+	if loadErr != nil {
+		Logger.Errorf("Cannot rebuild the SSH configuration: %v", loadErr)
+	} else {
+		Logger.Infof("SSH configuration rebuilt from %d files", len(config.IncludedFiles()))
+	}
+
+	// the files of the last successful load are kept watched, so fixing an
+	// invalid file triggers a new rebuild
+	if loadErr == nil || w.patterns == nil {
+		patterns, err := watchPatterns(w.Path, config)
+		if err != nil {
+			return nil, err
+		}
+		w.patterns = patterns
+	}
+	for _, dir := range watchedDirs(w.patterns) {
+		if err := watcher.Add(dir); err != nil {
+			return nil, err
+		}
+	}
+	if w.OnRebuild != nil {
+		w.OnRebuild(config, loadErr)
+	}
+
+	if loadErr != nil {
+		return nil, nil
+	}
+	// the files created in a new directory before it was watched are missed
+	if hasUnloadedFiles(config) {
+		return time.After(0), nil
+	}
+	if !config.cacheExpiry.IsZero() {
+		delay := config.cacheExpiry.Sub(time.Now())
+		if delay < w.Delay {
+			delay = w.Delay
+		}
+		Logger.Debugf("Cached inventories expire in %s", delay)
+		return time.After(delay), nil
+	}
+	return nil, nil
+}
+
+// hasUnloadedFiles returns true if files matching the include patterns were
+// created after the configuration was loaded
+func hasUnloadedFiles(config *Config) bool {
+	for pattern := range config.includePatterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			if _, found := config.includedFiles[match]; !found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w *Watcher) matches(path string) bool {
+	for _, pattern := range w.patterns {
+		if matchesPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchPatterns returns the paths and glob patterns of the files a
+// configuration depends on; the targets of the symlinks are included. The
+// inventory cache files are skipped, they are written by the rebuilds and
+// refreshed when they expire
+func watchPatterns(path string, config *Config) ([]string, error) {
+	expanded, err := utils.ExpandUser(path)
+	if err != nil {
+		return nil, err
+	}
+	patterns := map[string]bool{expanded: true}
+	if config != nil {
+		for _, file := range config.IncludedFiles() {
+			patterns[file] = true
+		}
+		for pattern := range config.includePatterns {
+			patterns[pattern] = true
+		}
+		cacheDir, err := utils.ExpandUser(config.inventoryCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		for file := range config.stamps {
+			if filepath.Dir(file) != filepath.Clean(cacheDir) {
+				patterns[file] = true
+			}
+		}
+	}
+	for pattern := range patterns {
+		if target, err := filepath.EvalSymlinks(pattern); err == nil {
+			patterns[target] = true
+		}
+	}
+
+	sorted := []string{}
+	for pattern := range patterns {
+		sorted = append(sorted, filepath.Clean(pattern))
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// watchedDirs returns the existing directories matching the directories of
+// the patterns, and their nearest existing parent while they do not exist or
+// contain a glob, so the creation of a matching directory is noticed
+func watchedDirs(patterns []string) []string {
+	dirs := map[string]bool{}
+	for _, pattern := range patterns {
+		dir := filepath.Dir(pattern)
+		for {
+			matches, _ := filepath.Glob(dir)
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.IsDir() {
+					dirs[match] = true
+				}
+			}
+			if (len(matches) > 0 && !hasGlobMeta(dir)) || dir == filepath.Dir(dir) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	sorted := []string{}
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// matchesPattern returns true if path matches the glob pattern or is a
+// directory on its way, i.e: "/etc/assh.d" for "/etc/assh.d/*.yml"
+func matchesPattern(pattern, path string) bool {
+	patternParts := strings.Split(filepath.Clean(pattern), string(filepath.Separator))
+	pathParts := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	if len(pathParts) > len(patternParts) {
+		return false
+	}
+	for idx, part := range pathParts {
+		if matched, _ := filepath.Match(patternParts[idx], part); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// inotifyWatcher is the dirWatcher of Linux
+type inotifyWatcher struct {
+	fd     int
+	file   *os.File
+	events chan string
+	errors chan error
+	done   chan struct{}
+
+	mutex sync.Mutex
+	dirs  map[int]string
+	wds   map[string]int
+}
+
+func newDirWatcher() (dirWatcher, error) {
+	// the non-blocking descriptor is handled by the runtime poller, so Close
+	// interrupts a pending read
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		dirs:   make(map[int]string),
+		wds:    make(map[string]int),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Add(dir string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, found := w.wds[dir]; found {
+		return nil
+	}
+	// file.Fd() would switch the descriptor back to the blocking mode
+	wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.dirs[wd] = dir
+	w.wds[dir] = wd
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan string { return w.events }
+func (w *inotifyWatcher) Errors() <-chan error  { return w.errors }
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+// send delivers an event or an error unless the watcher is closed
+func (w *inotifyWatcher) send(path string, err error) bool {
+	if err != nil {
+		select {
+		case w.errors <- err:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	select {
+	case w.events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *inotifyWatcher) readEvents() {
+	var buf [unix.SizeofInotifyEvent * 256]byte
+	for {
+		n, err := w.file.Read(buf[:])
+		if err != nil {
+			w.send("", err)
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// the changes are unknown, every directory may have changed
+				for _, dir := range w.watchedDirs() {
+					if !w.send(dir, nil) {
+						return
+					}
+				}
+				continue
+			}
+
+			w.mutex.Lock()
+			dir, found := w.dirs[int(event.Wd)]
+			if event.Mask&unix.IN_IGNORED != 0 {
+				// the directory was removed, it is watched again once recreated
+				delete(w.dirs, int(event.Wd))
+				delete(w.wds, dir)
+			}
+			w.mutex.Unlock()
+			if !found {
+				continue
+			}
+
+			path := dir
+			if name != "" {
+				path = filepath.Join(dir, name)
+			}
+			if !w.send(path, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (w *inotifyWatcher) watchedDirs() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	dirs := []string{}
+	for _, dir := range w.dirs {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
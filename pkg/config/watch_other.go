@@ -0,0 +1,119 @@
+//go:build !linux
+// +build !linux
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pollInterval is the period of the directory scans without inotify
+const pollInterval = time.Second
+
+// pollWatcher is the dirWatcher of the platforms without inotify, it
+// compares the sizes and modification dates of the entries periodically
+type pollWatcher struct {
+	events chan string
+	errors chan error
+	done   chan struct{}
+
+	mutex sync.Mutex
+	dirs  map[string]map[string]os.FileInfo
+}
+
+func newDirWatcher() (dirWatcher, error) {
+	w := &pollWatcher{
+		events: make(chan string),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+		dirs:   make(map[string]map[string]os.FileInfo),
+	}
+	go w.poll()
+	return w, nil
+}
+
+func (w *pollWatcher) Add(dir string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, found := w.dirs[dir]; found {
+		return nil
+	}
+	entries, err := scanDir(dir)
+	if err != nil {
+		return err
+	}
+	w.dirs[dir] = entries
+	return nil
+}
+
+func (w *pollWatcher) Events() <-chan string { return w.events }
+func (w *pollWatcher) Errors() <-chan error  { return w.errors }
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *pollWatcher) poll() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, path := range w.changes() {
+			select {
+			case w.events <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// changes scans the watched directories and returns the changed entries
+func (w *pollWatcher) changes() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	changed := []string{}
+	for dir, previous := range w.dirs {
+		entries, err := scanDir(dir)
+		if err != nil {
+			// the directory was removed, it is watched again once recreated
+			delete(w.dirs, dir)
+			changed = append(changed, dir)
+			continue
+		}
+		for name, entry := range entries {
+			if old, found := previous[name]; !found || old.Size() != entry.Size() || !old.ModTime().Equal(entry.ModTime()) {
+				changed = append(changed, filepath.Join(dir, name))
+			}
+		}
+		for name := range previous {
+			if _, found := entries[name]; !found {
+				changed = append(changed, filepath.Join(dir, name))
+			}
+		}
+		w.dirs[dir] = entries
+	}
+	return changed
+}
+
+func scanDir(dir string) (map[string]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]os.FileInfo, len(infos))
+	for _, info := range infos {
+		entries[info.Name()] = info
+	}
+	return entries, nil
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatchesPattern(t *testing.T) {
+	Convey("Testing matchesPattern()", t, func() {
+		So(matchesPattern("/etc/assh.d/*.yml", "/etc/assh.d/team.yml"), ShouldBeTrue)
+		So(matchesPattern("/etc/assh.d/*.yml", "/etc/assh.d"), ShouldBeTrue)
+		So(matchesPattern("/etc/assh.d/*.yml", "/etc"), ShouldBeTrue)
+		So(matchesPattern("/etc/assh.d/*.yml", "/etc/assh.d/team.yml.swp"), ShouldBeFalse)
+		So(matchesPattern("/etc/assh.d/*.yml", "/etc/assh.d/sub/team.yml"), ShouldBeFalse)
+		So(matchesPattern("/etc/assh.d/*.yml", "/etc/hosts"), ShouldBeFalse)
+		So(matchesPattern("/src/*/assh.yml", "/src/infra/assh.yml"), ShouldBeTrue)
+		So(matchesPattern("/src/*/assh.yml", "/src/infra"), ShouldBeTrue)
+	})
+}
+
+func TestWatchedDirs(t *testing.T) {
+	Convey("Testing watchedDirs()", t, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.MkdirAll(filepath.Join(dir, "src", "infra"), 0700), ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(dir, "src", "web"), 0700), ShouldBeNil)
+
+		So(watchedDirs([]string{
+			filepath.Join(dir, "assh.yml"),
+			filepath.Join(dir, "missing", "assh.d", "*.yml"),
+			filepath.Join(dir, "src", "*", "assh.yml"),
+		}), ShouldResemble, []string{
+			dir,
+			filepath.Join(dir, "src"),
+			filepath.Join(dir, "src", "infra"),
+			filepath.Join(dir, "src", "web"),
+		})
+	})
+}
+
+func TestWatcher(t *testing.T) {
+	Convey("Testing Watcher", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		sshConfigPath := filepath.Join(dir, "ssh_config")
+		mainPath := filepath.Join(dir, "assh.yml")
+		So(ioutil.WriteFile(mainPath, []byte("hosts:\n  aaa:\n    Port: 2222\nincludes:\n- "+filepath.Join(dir, "assh.d", "*.yml")+"\n"), 0644), ShouldBeNil)
+
+		rebuilt := make(chan *Config, 10)
+		watcher := NewWatcher(mainPath)
+		watcher.Delay = 50 * time.Millisecond
+		watcher.load = func(path string) (*Config, error) {
+			config := New()
+			config.sshConfigPath = sshConfigPath
+			return config, config.LoadFile(path)
+		}
+		watcher.OnRebuild = func(config *Config, err error) {
+			if err != nil {
+				config = nil
+			}
+			rebuilt <- config
+		}
+
+		stop := make(chan struct{})
+		done := make(chan error)
+		go func() { done <- watcher.Run(stop) }()
+		defer func() {
+			close(stop)
+			So(<-done, ShouldBeNil)
+		}()
+
+		timeout := &Config{}
+		next := func() *Config {
+			select {
+			case config := <-rebuilt:
+				return config
+			case <-time.After(5 * time.Second):
+				return timeout
+			}
+		}
+		sshConfig := func() string {
+			content, _ := ioutil.ReadFile(sshConfigPath)
+			return string(content)
+		}
+
+		config := next()
+		So(config, ShouldNotBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"aaa"})
+		So(sshConfig(), ShouldContainSubstring, "Host aaa")
+
+		// the include directory is created after the start
+		So(os.MkdirAll(filepath.Join(dir, "assh.d"), 0700), ShouldBeNil)
+		So(next(), ShouldNotEqual, timeout)
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "web.yml"), []byte("hosts:\n  web:\n    User: deploy\n"), 0644), ShouldBeNil)
+		config = next()
+		So(config, ShouldNotBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"aaa", "web"})
+		So(sshConfig(), ShouldContainSubstring, "Host web")
+
+		// the files not matching a pattern are ignored
+		So(ioutil.WriteFile(filepath.Join(dir, "assh.d", "notes.txt"), []byte("hello"), 0644), ShouldBeNil)
+
+		// editors replace the files with a rename
+		tmp := filepath.Join(dir, ".assh.yml.tmp")
+		So(ioutil.WriteFile(tmp, []byte("hosts:\n  bbb:\n    Port: 2222\nincludes:\n- "+filepath.Join(dir, "assh.d", "*.yml")+"\n"), 0644), ShouldBeNil)
+		So(os.Rename(tmp, mainPath), ShouldBeNil)
+		config = next()
+		So(config, ShouldNotBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"bbb", "web"})
+		So(sshConfig(), ShouldNotContainSubstring, "Host aaa")
+
+		// an invalid file keeps the previous SSH configuration
+		So(ioutil.WriteFile(mainPath, []byte("hosts: [\n"), 0644), ShouldBeNil)
+		config = next()
+		So(config, ShouldNotEqual, timeout)
+		So(config, ShouldBeNil)
+		So(sshConfig(), ShouldContainSubstring, "Host bbb")
+		So(os.Remove(filepath.Join(dir, "assh.d", "web.yml")), ShouldBeNil)
+		So(ioutil.WriteFile(mainPath, []byte("hosts:\n  ccc:\n    Port: 2222\n"), 0644), ShouldBeNil)
+		config = next()
+		So(config, ShouldNotBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"ccc"})
+
+		select {
+		case <-rebuilt:
+			So("unexpected rebuild", ShouldBeEmpty)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestWatchPatterns(t *testing.T) {
+	Convey("Testing watchPatterns()", t, func() {
+		config := New()
+		config.inventoryCacheDir = "/cache/assh"
+		config.includedFiles["/etc/assh.yml"] = true
+		config.includePatterns["/etc/assh.d/*.yml"] = []string{}
+		config.stamps["/etc/assh.yml"] = fileStamp{}
+		config.stamps["/etc/assh.yml.sig"] = fileStamp{}
+		config.stamps["/srv/terraform.tfstate"] = fileStamp{}
+		config.stamps["/cache/assh/0123.cache"] = fileStamp{}
+
+		patterns, err := watchPatterns("/etc/assh.yml", config)
+		So(err, ShouldBeNil)
+		So(patterns, ShouldResemble, []string{
+			"/etc/assh.d/*.yml",
+			"/etc/assh.yml",
+			"/etc/assh.yml.sig",
+			"/srv/terraform.tfstate",
+		})
+	})
+}
+
+func TestWatcher_Dependencies(t *testing.T) {
+	Convey("Testing Watcher with inventories", t, FailureContinues, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		mainPath := filepath.Join(dir, "assh.yml")
+		inventoryPath := filepath.Join(dir, "inventory", "hosts.ini")
+		So(os.MkdirAll(filepath.Dir(inventoryPath), 0700), ShouldBeNil)
+		So(ioutil.WriteFile(inventoryPath, []byte("db-1 ansible_host=10.0.0.1\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(mainPath, []byte("includes:\n- provider: ansible\n  path: "+inventoryPath+"\n"), 0644), ShouldBeNil)
+
+		rebuilt := make(chan *Config, 10)
+		expiry := time.Now().Add(300 * time.Millisecond)
+		watcher := NewWatcher(mainPath)
+		watcher.Delay = 50 * time.Millisecond
+		watcher.load = func(path string) (*Config, error) {
+			config := New()
+			config.sshConfigPath = filepath.Join(dir, "ssh_config")
+			config.inventoryCacheDir = filepath.Join(dir, "cache")
+			err := config.LoadFile(path)
+			// a cached inventory expiring once
+			if time.Now().Before(expiry) {
+				config.cacheExpiry = expiry
+			}
+			return config, err
+		}
+		watcher.OnRebuild = func(config *Config, err error) {
+			if err != nil {
+				config = nil
+			}
+			rebuilt <- config
+		}
+
+		stop := make(chan struct{})
+		done := make(chan error)
+		go func() { done <- watcher.Run(stop) }()
+		defer func() {
+			close(stop)
+			So(<-done, ShouldBeNil)
+		}()
+
+		timeout := &Config{}
+		next := func() *Config {
+			select {
+			case config := <-rebuilt:
+				return config
+			case <-time.After(5 * time.Second):
+				return timeout
+			}
+		}
+
+		config := next()
+		So(config, ShouldNotBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"db-1"})
+
+		// the configuration is rebuilt when the inventory expires
+		config = next()
+		So(config, ShouldNotEqual, timeout)
+		So(time.Now().Before(expiry), ShouldBeFalse)
+
+		// the inventory file is watched
+		So(ioutil.WriteFile(inventoryPath, []byte("db-1 ansible_host=10.0.0.1\ndb-2 ansible_host=10.0.0.2\n"), 0644), ShouldBeNil)
+		config = next()
+		So(config, ShouldNotBeNil)
+		So(config.sortedNames(), ShouldResemble, []string{"db-1", "db-2"})
+
+		select {
+		case <-rebuilt:
+			So("unexpected rebuild", ShouldBeEmpty)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
@@ -1,29 +1,488 @@
 package flexyaml
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 )
 
-func MakeFlexible(in []byte) ([]byte, error) {
-	lines := []string{}
-	for _, line := range strings.Split(string(in), "\n") {
-		if strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			line = fmt.Sprintf("%s:%s", strings.ToLower(parts[0]), parts[1])
+// KeyLines returns the line number of every block mapping key of a YAML
+// document, indexed by their lowercased path (i.e: "hosts/foo/hostname").
+// Keys declared in flow style or inside sequences are not indexed.
+func KeyLines(in []byte) map[string]int {
+	type level struct {
+		indent int
+		key    string
+	}
+
+	lines := map[string]int{}
+	stack := []level{}
+	for idx, line := range strings.Split(string(in), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '-' {
+			continue
+		}
+		key, ok := parseKey(trimmed)
+		if !ok {
+			continue
+		}
+
+		indent := len(line) - len(trimmed)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent: indent, key: strings.ToLower(key)})
+
+		keys := []string{}
+		for _, entry := range stack {
+			keys = append(keys, entry.key)
+		}
+		path := strings.Join(keys, "/")
+		if _, found := lines[path]; !found {
+			lines[path] = idx + 1
+		}
+	}
+	return lines
+}
+
+// parseKey returns the key of a "key: value" line
+func parseKey(line string) (string, bool) {
+	if line[0] == '"' || line[0] == '\'' {
+		end := strings.IndexByte(line[1:], line[0])
+		if end < 0 {
+			return "", false
+		}
+		key := line[1 : end+1]
+		rest := strings.TrimLeft(line[end+2:], " ")
+		return key, strings.HasPrefix(rest, ":")
+	}
+
+	for idx := 0; idx < len(line); idx++ {
+		if line[idx] == ':' && (idx+1 == len(line) || line[idx+1] == ' ' || line[idx+1] == '\t') {
+			return strings.TrimRight(line[:idx], " "), true
+		}
+	}
+	return "", false
+}
+
+// Document is a parsed YAML document, it may be decoded several times
+type Document struct {
+	in    []byte
+	tree  yaml.MapSlice
+	lines map[string]int
+}
+
+// Parse parses a YAML document, the top-level node must be a mapping
+func Parse(in []byte) (*Document, error) {
+	doc := &Document{in: in}
+	if err := yaml.Unmarshal(in, &doc.tree); err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(in, []byte("<<")) {
+		// yaml drops the merge keys when decoding into a MapSlice, take
+		// them from a generic decode
+		var merged interface{}
+		if err := yaml.Unmarshal(in, &merged); err != nil {
+			return nil, err
+		}
+		doc.tree, _ = withMerges(doc.tree, merged).(yaml.MapSlice)
+	}
+	return doc, nil
+}
+
+// withMerges returns the ordered value with the keys only found in the
+// merged value, the merged keys are added sorted before the declared ones
+func withMerges(ordered, merged interface{}) interface{} {
+	switch ordered := ordered.(type) {
+	case yaml.MapSlice:
+		mergedMap, _ := merged.(map[interface{}]interface{})
+		declared := map[interface{}]bool{}
+		for _, item := range ordered {
+			if item.Key == nil || reflect.TypeOf(item.Key).Comparable() {
+				declared[item.Key] = true
+			}
+		}
+
+		ret := yaml.MapSlice{}
+		for _, item := range toMapSlice(mergedMap).(yaml.MapSlice) {
+			if !declared[item.Key] {
+				ret = append(ret, item)
+			}
+		}
+		for _, item := range ordered {
+			var value interface{}
+			if item.Key == nil || reflect.TypeOf(item.Key).Comparable() {
+				value = mergedMap[item.Key]
+			}
+			ret = append(ret, yaml.MapItem{Key: item.Key, Value: withMerges(item.Value, value)})
+		}
+		return ret
+	case []interface{}:
+		mergedSlice, _ := merged.([]interface{})
+		ret := make([]interface{}, 0, len(ordered))
+		for idx, entry := range ordered {
+			var value interface{}
+			if idx < len(mergedSlice) {
+				value = mergedSlice[idx]
+			}
+			ret = append(ret, withMerges(entry, value))
 		}
-		lines = append(lines, line)
+		return ret
 	}
-	return []byte(strings.Join(lines, "\n")), nil
+	return ordered
 }
 
-func Unmarshal(in []byte, out interface{}) (err error) {
-	flex, err := MakeFlexible(in)
+// toMapSlice converts the generic maps of value into MapSlices sorted by key
+func toMapSlice(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		ret := yaml.MapSlice{}
+		for key, entry := range value {
+			ret = append(ret, yaml.MapItem{Key: key, Value: toMapSlice(entry)})
+		}
+		sort.Sort(byKey(ret))
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, 0, len(value))
+		for _, entry := range value {
+			ret = append(ret, toMapSlice(entry))
+		}
+		return ret
+	}
+	return value
+}
+
+type byKey yaml.MapSlice
+
+func (s byKey) Len() int           { return len(s) }
+func (s byKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool { return fmt.Sprint(s[i].Key) < fmt.Sprint(s[j].Key) }
+
+// KeyLines returns the KeyLines of the document
+func (doc *Document) KeyLines() map[string]int {
+	if doc.lines == nil {
+		doc.lines = KeyLines(doc.in)
+	}
+	return doc.lines
+}
+
+// Unmarshal decodes a YAML document into out, matching the mapping keys
+// against the struct fields of out case-insensitively.
+// Only the keys of mappings decoded into structs are normalized, the keys of
+// mappings decoded into maps (i.e: host names) and the values are kept as is.
+func Unmarshal(in []byte, out interface{}) error {
+	doc, err := Parse(in)
+	if err != nil {
+		return err
+	}
+	return doc.Decode(out)
+}
+
+// Decode decodes the document into out like Unmarshal: the keys are
+// normalized for the type of out, the document is encoded again and decoded
+// by yaml, the lines of the errors are the ones of the original document
+func (doc *Document) Decode(out interface{}) error {
+	if doc.tree == nil {
+		// empty document, leave out untouched
+		return nil
+	}
+
+	normalized, err := yaml.Marshal((&normalizer{in: doc.in}).normalize(doc.tree, reflect.TypeOf(out), nil))
 	if err != nil {
 		return err
 	}
 
-	return yaml.Unmarshal(flex, out)
+	err = yaml.Unmarshal(normalized, out)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		// the errors refer to the normalized document, point them to the input instead
+		translate := lineTranslator(normalized, doc.KeyLines())
+		for idx, msg := range typeErr.Errors {
+			typeErr.Errors[idx] = lineErrorRegex.ReplaceAllStringFunc(msg, func(match string) string {
+				line, _ := strconv.Atoi(lineErrorRegex.FindStringSubmatch(match)[1])
+				return fmt.Sprintf("line %d:", translate(line))
+			})
+		}
+	}
+	return err
+}
+
+// Filter returns the document without the mapping keys and sequence entries
+// for which remove returns true, encoded again for the out type like by
+// Unmarshal, and the paths of the removed entries. remove is called with the
+// lowercased path of the entry (sequence entries are "-", i.e:
+// ["matches", "-", "exec"]) and its generic value.
+// The lines of the returned document do not match the input.
+func Filter(in []byte, out interface{}, remove func(path []string, value interface{}) bool) ([]byte, []string, error) {
+	doc, err := Parse(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.tree == nil {
+		return in, nil, nil
+	}
+
+	removed := []string{}
+	tree := filter(doc.tree, nil, nil, remove, &removed)
+	filtered, err := yaml.Marshal((&normalizer{in: in}).normalize(tree, reflect.TypeOf(out), nil))
+	return filtered, removed, err
+}
+
+// filter returns a copy of value without the entries for which remove
+// returns true, the sequence entries keep their index in the paths given to
+// the normalizer
+func filter(value interface{}, path, display []string, remove func([]string, interface{}) bool, removed *[]string) interface{} {
+	child := func(parent []string, key string) []string {
+		return append(append([]string{}, parent...), key)
+	}
+
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		kept := make(yaml.MapSlice, 0, len(value))
+		for _, item := range value {
+			key := fmt.Sprintf("%v", item.Key)
+			if remove(child(path, strings.ToLower(key)), item.Value) {
+				*removed = append(*removed, strings.Join(child(display, key), "/"))
+				continue
+			}
+			kept = append(kept, yaml.MapItem{
+				Key:   item.Key,
+				Value: filter(item.Value, child(path, strings.ToLower(key)), child(display, key), remove, removed),
+			})
+		}
+		return kept
+	case []interface{}:
+		kept := make([]interface{}, 0, len(value))
+		for idx, entry := range value {
+			if remove(child(path, "-"), entry) {
+				*removed = append(*removed, strings.Join(child(display, strconv.Itoa(idx)), "/"))
+				continue
+			}
+			kept = append(kept, filteredEntry{
+				index: idx,
+				value: filter(entry, child(path, "-"), child(display, strconv.Itoa(idx)), remove, removed),
+			})
+		}
+		return kept
+	}
+	return value
+}
+
+// filteredEntry is a sequence entry kept by filter with its original index
+type filteredEntry struct {
+	index int
+	value interface{}
+}
+
+var (
+	lineErrorRegex  = regexp.MustCompile(`^line (\d+):`)
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	interfaceType   = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+type structField struct {
+	key       string
+	fieldType reflect.Type
+}
+
+// structFields caches the yaml keys of the struct types indexed by their
+// lowercased version
+var structFields = struct {
+	sync.RWMutex
+	types map[reflect.Type]map[string]structField
+}{types: map[reflect.Type]map[string]structField{}}
+
+// getStructFields returns the yaml keys of a struct type indexed by their lowercased version
+func getStructFields(structType reflect.Type) map[string]structField {
+	structFields.RLock()
+	fields, found := structFields.types[structType]
+	structFields.RUnlock()
+	if found {
+		return fields
+	}
+
+	fields = map[string]structField{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		fields[strings.ToLower(key)] = structField{key: key, fieldType: field.Type}
+	}
+
+	structFields.Lock()
+	structFields.types[structType] = fields
+	structFields.Unlock()
+	return fields
+}
+
+// index is a sequence index in the path of a value
+type index int
+
+// originalText is the target of the values decoded by an unmarshaler, their
+// scalars keep the original text
+type originalText struct{}
+
+var (
+	originalTextType = reflect.TypeOf(originalText{})
+	mapSliceType     = reflect.TypeOf(yaml.MapSlice{})
+)
+
+// normalizer renames the keys of the mappings decoded into structs to the
+// exact keys expected by the struct fields. The scalars decoded into strings
+// get back their original text (i.e: "yes" or "0177" instead of true or
+// 127), like when yaml decodes the input directly.
+type normalizer struct {
+	in []byte
+	// texts are the views of the input with the scalars decoded as
+	// strings, by shape of path
+	texts map[string]reflect.Value
+}
+
+// normalize returns value ready to be decoded into target, path is the path
+// of value in the input
+func (n *normalizer) normalize(value interface{}, target reflect.Type, path []interface{}) interface{} {
+	if entry, ok := value.(filteredEntry); ok {
+		path[len(path)-1] = index(entry.index)
+		value = entry.value
+	}
+	for target != nil && target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	switch {
+	case target == nil || target == mapSliceType:
+		target = interfaceType
+	case target != originalTextType && reflect.PtrTo(target).Implements(unmarshalerType):
+		target = originalTextType
+	}
+
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		ret := make(yaml.MapSlice, 0, len(value))
+		for _, item := range value {
+			key, valueType := item.Key, elemType(target)
+			if target.Kind() == reflect.Struct && target != originalTextType {
+				name, _ := item.Key.(string)
+				if field, found := getStructFields(target)[strings.ToLower(name)]; found {
+					key, valueType = field.key, field.fieldType
+				}
+			}
+			ret = append(ret, yaml.MapItem{Key: key, Value: n.normalize(item.Value, valueType, appendPath(path, item.Key))})
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, 0, len(value))
+		for idx, entry := range value {
+			ret = append(ret, n.normalize(entry, elemType(target), appendPath(path, index(idx))))
+		}
+		return ret
+	case string, nil:
+		return value
+	}
+
+	if target == originalTextType || target.Kind() == reflect.String {
+		if text, found := n.text(path); found {
+			return text
+		}
+	}
+	return value
+}
+
+// elemType returns the type of the values of a map or slice target
+func elemType(target reflect.Type) reflect.Type {
+	if target == originalTextType {
+		return target
+	}
+	switch target.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return target.Elem()
+	}
+	return interfaceType
+}
+
+func appendPath(path []interface{}, step interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(path)+1), path...), step)
+}
+
+// text returns the original text of the scalar at path, the input is
+// decoded once by shape of path into nested maps and slices of strings
+func (n *normalizer) text(path []interface{}) (string, bool) {
+	shape := ""
+	textType := reflect.TypeOf("")
+	for idx := len(path) - 1; idx >= 0; idx-- {
+		if _, ok := path[idx].(index); ok {
+			shape = "-" + shape
+			textType = reflect.SliceOf(textType)
+		} else {
+			shape = "m" + shape
+			textType = reflect.MapOf(interfaceType, textType)
+		}
+	}
+
+	if n.texts == nil {
+		n.texts = map[string]reflect.Value{}
+	}
+	view, found := n.texts[shape]
+	if !found {
+		view = reflect.New(textType)
+		// the entries of other shapes are type errors
+		_ = yaml.Unmarshal(n.in, view.Interface())
+		view = view.Elem()
+		n.texts[shape] = view
+	}
+
+	for _, step := range path {
+		if idx, ok := step.(index); ok {
+			if int(idx) >= view.Len() {
+				return "", false
+			}
+			view = view.Index(int(idx))
+			continue
+		}
+		if step == nil {
+			return "", false
+		}
+		view = view.MapIndex(reflect.ValueOf(step))
+		if !view.IsValid() {
+			return "", false
+		}
+	}
+	text := view.String()
+	return text, text != ""
+}
+
+// lineTranslator returns a function converting a line of the normalized
+// document into the line of the same key in the original document
+func lineTranslator(normalized []byte, originalLines map[string]int) func(int) int {
+	paths := map[int]string{}
+	for path, line := range KeyLines(normalized) {
+		paths[line] = path
+	}
+
+	return func(line int) int {
+		// use the closest key declared before the line
+		for candidate := line; candidate > 0; candidate-- {
+			if path, found := paths[candidate]; found {
+				if originalLine, found := originalLines[path]; found {
+					return originalLine
+				}
+				return line
+			}
+		}
+		return line
+	}
 }
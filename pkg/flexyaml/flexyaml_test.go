@@ -1,149 +1,91 @@
 package flexyaml
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
 	"testing"
 
+	"gopkg.in/yaml.v2"
+
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func TestMakeFlexible(t *testing.T) {
-	Convey("Testing MakeFlexible()", t, FailureContinues, func() {
-		var input, output []byte
-		var err error
-
-		input = []byte("somekey: ok")
-		output, err = MakeFlexible(input)
-		So(err, ShouldBeNil)
-		So(output, ShouldResemble, []byte("somekey: ok"))
-
-		input = []byte("SomeKey: ok")
-		output, err = MakeFlexible(input)
-		So(err, ShouldBeNil)
-		So(output, ShouldResemble, []byte("somekey: ok"))
-
-		input = []byte("SOMEKEY: ok")
-		output, err = MakeFlexible(input)
-		So(err, ShouldBeNil)
-		So(output, ShouldResemble, []byte("somekey: ok"))
-
-		input = []byte("sOmEkEy: ok")
-		output, err = MakeFlexible(input)
-		So(err, ShouldBeNil)
-		So(output, ShouldResemble, []byte("somekey: ok"))
-
-		expected := []byte(`hosts:
-
-  aaa:
-    hostname: 1.2.3.4
-
-  bbb:
-    port: 21
-
-  ccc:
-    hostname: 5.6.7.8
-    port: 24
-    user: Toor
-  "*.ddd":
-    hostname: 1.3.5.7
-
-  eee:
-    inherits:
-    - aaa
-    - bBb
-    - aaa
-
-  fff:
-    inherits:
-    - bbb
-    - eee
-    - "*.ddd"
-
-  ggg:
-    gateways:
-    - direct
-    - fff
-
-  hhh:
-    gateways:
-    - ggg
-    - direct
-
-  iii:
-    gateways:
-    - test.ddd
-
-  jjj:
-    hostname: "%h.jjjjj"
-
-  "*.kkk":
-    hostname: "%h.kkkkk"
-
-defaults:
-  port: 22
-  user: root
-
-includes:
-  - /path/to/dir/*.yml
-  - /path/to/file.yml
-`)
-		input = []byte(`hosts:
+func TestUnmarshal_structure(t *testing.T) {
+	Convey("Testing Unmarshal() with nested structures", t, FailureContinues, func() {
+		type Host struct {
+			HostName string   `yaml:"hostname"`
+			Port     string   `yaml:"port"`
+			User     string   `yaml:"user"`
+			Compress string   `yaml:"compression"`
+			Umask    string   `yaml:"umask"`
+			Inherits []string `yaml:"inherits"`
+			Hooks    struct {
+				OnConnect []string `yaml:"onconnect"`
+			} `yaml:"hooks"`
+		}
+		type C struct {
+			Hosts    map[string]*Host `yaml:"hosts"`
+			Defaults Host             `yaml:"defaults"`
+			Includes []string         `yaml:"includes"`
+		}
 
-  aaa:
+		var out C
+		err := Unmarshal([]byte(`Hosts:
+  MyServer:
     HostName: 1.2.3.4
-
-  bBb:
-    Port: 21
-
-  ccc:
-    HostName: 5.6.7.8
-    Port: 24
     USER: Toor
-  "*.ddd":
-    hostName: 1.3.5.7
-
-  eee:
-    Inherits:
-    - aaa
-    - bBb
-    - aaa
-
-  fff:
+    Compression: yes
+    Umask: 0177
     Inherits:
-    - bbb
-    - eee
-    - "*.ddd"
+    - BaseTemplate
+    Hooks:
+      OnConnect:
+      - exec echo Host:{{.Host.Name}}
 
-  ggg:
-    Gateways:
-    - direct
-    - fff
+  "*.DDD":
+    hostName: 1.3.5.7
 
-  hhh:
-    Gateways:
-    - ggg
-    - direct
+DEFAULTS:
+  Port: "22"
 
-  iii:
-    Gateways:
-    - test.ddd
+includes:
+  - /path/To/Dir/*.yml
+`), &out)
+		So(err, ShouldBeNil)
+		So(len(out.Hosts), ShouldEqual, 2)
+		So(out.Hosts["MyServer"], ShouldNotBeNil)
+		So(out.Hosts["MyServer"].HostName, ShouldEqual, "1.2.3.4")
+		So(out.Hosts["MyServer"].User, ShouldEqual, "Toor")
+		So(out.Hosts["MyServer"].Compress, ShouldEqual, "yes")
+		So(out.Hosts["MyServer"].Umask, ShouldEqual, "0177")
+		So(out.Hosts["MyServer"].Inherits, ShouldResemble, []string{"BaseTemplate"})
+		So(out.Hosts["MyServer"].Hooks.OnConnect, ShouldResemble, []string{"exec echo Host:{{.Host.Name}}"})
+		So(out.Hosts["*.DDD"], ShouldNotBeNil)
+		So(out.Hosts["*.DDD"].HostName, ShouldEqual, "1.3.5.7")
+		So(out.Defaults.Port, ShouldEqual, "22")
+		So(out.Includes, ShouldResemble, []string{"/path/To/Dir/*.yml"})
+	})
 
-  jjj:
-    HostName: "%h.jjjjj"
+	Convey("Testing Unmarshal() errors", t, FailureContinues, func() {
+		type C struct {
+			Hosts map[string]struct {
+				Port int `yaml:"port"`
+			} `yaml:"hosts"`
+		}
 
-  "*.kkk":
-    HostName: "%h.kkkkk"
+		var out C
+		err := Unmarshal([]byte(`# comment
+HOSTS:
 
-defaults:
-  Port: 22
-  User: root
+  aaa:
+    Port: abc
+`), &out)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line 5: cannot unmarshal !!str `abc` into int")
 
-includes:
-  - /path/to/dir/*.yml
-  - /path/to/file.yml
-`)
-		output, err = MakeFlexible(input)
-		So(err, ShouldBeNil)
-		So(string(output), ShouldEqual, string(expected))
+		err = Unmarshal([]byte("hosts: [\n"), &out)
+		So(err, ShouldNotBeNil)
 	})
 }
 
@@ -175,3 +117,216 @@ func TestUnmarshal(t *testing.T) {
 		So(out.SomeKey, ShouldEqual, "ok")
 	})
 }
+
+func TestKeyLines(t *testing.T) {
+	Convey("Testing KeyLines()", t, FailureContinues, func() {
+		lines := KeyLines([]byte(`# comment
+hosts:
+
+  aaa:
+    HostName: 1.2.3.4
+    Inherits:
+    - bbb
+  "*.ddd":
+    hostname: "a: b"
+
+defaults:
+  Port: 22
+`))
+		So(lines, ShouldResemble, map[string]int{
+			"hosts":                2,
+			"hosts/aaa":            4,
+			"hosts/aaa/hostname":   5,
+			"hosts/aaa/inherits":   6,
+			"hosts/*.ddd":          8,
+			"hosts/*.ddd/hostname": 9,
+			"defaults":             11,
+			"defaults/port":        12,
+		})
+	})
+}
+
+func TestFilter(t *testing.T) {
+	Convey("Testing Filter()", t, FailureContinues, func() {
+		type Host struct {
+			User         string `yaml:"user"`
+			ProxyCommand string `yaml:"proxycommand"`
+		}
+		type C struct {
+			Hosts   map[string]*Host `yaml:"hosts"`
+			Matches []struct {
+				Exec string `yaml:"exec"`
+				Host string `yaml:"host"`
+			} `yaml:"matches"`
+		}
+		input := []byte(`Hosts:
+  aaa:
+    User: yes
+    ProxyCommand: nc %h %p
+matches:
+- exec: "true"
+  host: "*.a"
+- host: "*.b"
+`)
+
+		paths := [][]string{}
+		filtered, removed, err := Filter(input, &C{}, func(path []string, value interface{}) bool {
+			paths = append(paths, path)
+			last := path[len(path)-1]
+			return last == "proxycommand" || last == "exec"
+		})
+		So(err, ShouldBeNil)
+		So(removed, ShouldResemble, []string{"Hosts/aaa/ProxyCommand", "matches/0/exec"})
+		So(paths, ShouldContain, []string{"matches", "-", "host"})
+
+		var out C
+		So(Unmarshal(filtered, &out), ShouldBeNil)
+		So(out.Hosts["aaa"].User, ShouldEqual, "yes")
+		So(out.Hosts["aaa"].ProxyCommand, ShouldEqual, "")
+		So(len(out.Matches), ShouldEqual, 2)
+		So(out.Matches[0].Exec, ShouldEqual, "")
+		So(out.Matches[0].Host, ShouldEqual, "*.a")
+
+		Convey("Removing sequence entries", func() {
+			filtered, removed, err := Filter(input, &C{}, func(path []string, value interface{}) bool {
+				return len(path) == 2 && path[0] == "matches" && len(value.(yaml.MapSlice)) == 2
+			})
+			So(err, ShouldBeNil)
+			So(removed, ShouldResemble, []string{"matches/0"})
+			var out C
+			So(Unmarshal(filtered, &out), ShouldBeNil)
+			So(len(out.Matches), ShouldEqual, 1)
+			So(out.Matches[0].Host, ShouldEqual, "*.b")
+		})
+	})
+}
+
+type upperString string
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface
+func (u *upperString) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	*u = upperString(strings.ToUpper(value))
+	return nil
+}
+
+func TestDocument_Decode(t *testing.T) {
+	Convey("Testing Document.Decode()", t, FailureContinues, func() {
+		type Host struct {
+			HostName string      `yaml:"hostname"`
+			Port     int         `yaml:"port"`
+			Enabled  bool        `yaml:"enabled"`
+			Alias    upperString `yaml:"alias"`
+			Tags     []string    `yaml:"tags"`
+		}
+		type C struct {
+			Hosts    map[string]*Host `yaml:"hosts"`
+			Defaults Host             `yaml:"defaults"`
+			Extra    interface{}      `yaml:"extra"`
+		}
+
+		doc, err := Parse([]byte(`base: &base
+  Port: 2222
+  Tags: [a, b]
+Hosts:
+  "yes":
+    <<: *base
+    HostName: on
+    Enabled: yes
+    Alias: web
+  "0177":
+Defaults:
+  hostname: 0x10
+Extra:
+  Key: [1, "2", {three: 3}]
+`))
+		So(err, ShouldBeNil)
+
+		var out C
+		So(doc.Decode(&out), ShouldBeNil)
+		So(len(out.Hosts), ShouldEqual, 2)
+		So(out.Hosts["yes"], ShouldResemble, &Host{
+			HostName: "on",
+			Port:     2222,
+			Enabled:  true,
+			Alias:    "WEB",
+			Tags:     []string{"a", "b"},
+		})
+		So(out.Hosts["0177"], ShouldBeNil)
+		So(out.Defaults.HostName, ShouldEqual, "0x10")
+		So(out.Extra, ShouldResemble, map[interface{}]interface{}{
+			"Key": []interface{}{1, "2", map[interface{}]interface{}{"three": 3}},
+		})
+
+		// the document is decoded into existing values like yaml does
+		out.Defaults.Port = 22
+		out.Hosts["other"] = &Host{}
+		So(doc.Decode(&out), ShouldBeNil)
+		So(out.Defaults.Port, ShouldEqual, 22)
+		So(len(out.Hosts), ShouldEqual, 3)
+
+		var ordered struct {
+			Hosts yaml.MapSlice `yaml:"hosts"`
+		}
+		So(doc.Decode(&ordered), ShouldBeNil)
+		So(len(ordered.Hosts), ShouldEqual, 2)
+		So(ordered.Hosts[0].Key, ShouldEqual, "yes")
+		So(ordered.Hosts[1].Key, ShouldEqual, "0177")
+		So(ordered.Hosts[0].Value, ShouldResemble, yaml.MapSlice{
+			{Key: "Port", Value: 2222},
+			{Key: "Tags", Value: []interface{}{"a", "b"}},
+			{Key: "HostName", Value: true},
+			{Key: "Enabled", Value: true},
+			{Key: "Alias", Value: "web"},
+		})
+
+		Convey("with type errors", func() {
+			doc, err := Parse([]byte(`hosts:
+  aaa:
+    Port: abc
+    Tags:
+      key: value
+  bbb:
+    Port: 22
+`))
+			So(err, ShouldBeNil)
+			var out C
+			err = doc.Decode(&out)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 3: cannot unmarshal !!str `abc` into int")
+			So(err.Error(), ShouldContainSubstring, "line 5: cannot unmarshal !!map into []string")
+			So(out.Hosts["bbb"].Port, ShouldEqual, 22)
+		})
+	})
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	type Host struct {
+		HostName string   `yaml:"hostname"`
+		User     string   `yaml:"user"`
+		Port     string   `yaml:"port"`
+		Inherits []string `yaml:"inherits"`
+		Gateways []string `yaml:"gateways"`
+	}
+	type C struct {
+		Hosts     map[string]*Host `yaml:"hosts"`
+		Templates map[string]*Host `yaml:"templates"`
+	}
+
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "templates:\n  tpl:\n    User: user\n    Port: 2222\nhosts:\n")
+	for host := 0; host < 100; host++ {
+		fmt.Fprintf(&in, "  host-%d:\n    HostName: 10.0.%d.1\n    Inherits: [tpl]\n    Gateways: [direct, jump]\n", host, host)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var out C
+		if err := Unmarshal(in.Bytes(), &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	Convey("Testing WriteFileAtomic()", t, func() {
+		dir, err := ioutil.TempDir(os.TempDir(), "assh-tests")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		filename := filepath.Join(dir, "config")
+		So(WriteFileAtomic(filename, []byte("first"), 0600), ShouldBeNil)
+		content, err := ioutil.ReadFile(filename)
+		So(err, ShouldBeNil)
+		So(string(content), ShouldEqual, "first")
+		info, err := os.Stat(filename)
+		So(err, ShouldBeNil)
+		So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+		// the mode of the existing file is kept
+		So(os.Chmod(filename, 0640), ShouldBeNil)
+		So(WriteFileAtomic(filename, []byte("second"), 0644), ShouldBeNil)
+		info, err = os.Stat(filename)
+		So(err, ShouldBeNil)
+		So(info.Mode().Perm(), ShouldEqual, os.FileMode(0640))
+
+		// the symlinks are followed
+		link := filepath.Join(dir, "link")
+		So(os.Symlink(filename, link), ShouldBeNil)
+		So(WriteFileAtomic(link, []byte("third"), 0644), ShouldBeNil)
+		info, err = os.Lstat(link)
+		So(err, ShouldBeNil)
+		So(info.Mode()&os.ModeSymlink, ShouldNotEqual, 0)
+		content, err = ioutil.ReadFile(filename)
+		So(err, ShouldBeNil)
+		So(string(content), ShouldEqual, "third")
+
+		// no temporary file is left
+		files, err := ioutil.ReadDir(dir)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 2)
+	})
+}